@@ -0,0 +1,540 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/super1-chen/fxoss/notify"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	alertRulesYAML = "fx_alerts.yaml"
+	alertDir       = "alerts"
+	alertStateJSON = "state.json"
+	alertStateLock = "state.lock"
+	// a lock file older than alertLockStale is left by a killed process and is removed
+	alertLockStale   = time.Minute
+	alertLockTimeout = 10 * time.Second
+	// resolved alerts are removed from state after alertRetention
+	alertRetention = 7 * 24 * time.Hour
+)
+
+// alertState is the state of an alert identified by rule and target, it is saved on disk
+type alertState struct {
+	Rule       string    `json:"rule"`
+	Target     string    `json:"target"` // sn of cds, sn of cds/sn of node or sn of cds/name of disk
+	Kind       string    `json:"kind"`
+	CDSSN      string    `json:"cds_sn"`
+	Company    string    `json:"company"`
+	Severity   string    `json:"severity"`
+	Status     string    `json:"status"` // pending, firing or resolved
+	Value      string    `json:"value"`
+	Since      time.Time `json:"since"` // the first time the rule matched
+	FiredAt    time.Time `json:"fired_at"`
+	ResolvedAt time.Time `json:"resolved_at"`
+	NotifiedAt time.Time `json:"notified_at"`
+}
+
+// alertMatch is a target matching a rule in an evaluation
+type alertMatch struct {
+	rule                         *alertRule
+	target, kind, cdsSN, company string
+	value                        string
+}
+
+// alertEvent is a change of alert reported to user, kind is firing, repeat or resolved
+type alertEvent struct {
+	kind  string
+	state *alertState
+}
+
+// CheckAlerts evaluates alert rules once, updates alert state and shows pending and firing alerts.
+// Firing and resolved alerts of the evaluation are printed and sent like RunAlerts, as they are not
+// reported again. It returns the count of firing alerts.
+func (oss *OSS) CheckAlerts(now time.Time, rulesFile string) (int, error) {
+	rules, err := loadAlertRules(rulesFile)
+	if err != nil {
+		return 0, err
+	}
+	states, events, err := oss.evaluateAlerts(now, rules)
+	if err != nil {
+		return 0, err
+	}
+	oss.reportAlertEvents(events, now)
+
+	var active []*alertState
+	firing := 0
+	for _, st := range states {
+		if st.Status == "resolved" {
+			continue
+		}
+		if st.Status == "firing" {
+			firing++
+		}
+		active = append(active, st)
+	}
+	if len(active) == 0 {
+		utils.SuccessPrintln(fmt.Sprintf("No alert fires, %d rules checked", len(rules)))
+		return 0, nil
+	}
+	sortAlertStates(active)
+
+	headers := []string{"#", "severity", "status", "rule", "target", "company", "value", "since"}
+	var content [][]string
+	for index, st := range active {
+		index++
+		status := st.Status
+		if status == "firing" {
+			status = severityText(status, st.Severity)
+		}
+		content = append(content, []string{
+			strconv.Itoa(index),
+			st.Severity,
+			status,
+			st.Rule,
+			st.Target,
+			st.Company,
+			st.Value,
+			utils.FormatAgo(now.Sub(st.Since)),
+		})
+	}
+	utils.PrintTable(headers, content)
+	return firing, nil
+}
+
+// RunAlerts evaluates alert rules every interval and prints firing and resolved alerts until it is stopped
+func (oss *OSS) RunAlerts(interval time.Duration, rulesFile string) error {
+	if interval <= 0 {
+		return fmt.Errorf("illegal interval %s", interval)
+	}
+	rules, err := loadAlertRules(rulesFile)
+	if err != nil {
+		return err
+	}
+	utils.SuccessPrintln(fmt.Sprintf("Evaluate %d rules every %s", len(rules), interval))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		oss.ensureToken(now)
+		_, events, err := oss.evaluateAlerts(now, rules)
+		if err != nil {
+			utils.ErrorPrintln(fmt.Sprintf("%s 告警检查失败: %v", now.Format(time.RFC3339), err), false)
+		}
+		oss.reportAlertEvents(events, now)
+
+		select {
+		case <-ticker.C:
+		case sig := <-sigs:
+			utils.ColorPrintln(fmt.Sprintf("receive signal %s, stop alerts", sig), utils.Yellow)
+			return nil
+		}
+	}
+}
+
+// reportAlertEvents prints alert events and sends them to notifiers
+func (oss *OSS) reportAlertEvents(events []*alertEvent, now time.Time) {
+	for _, e := range events {
+		printAlertEvent(e, now)
+	}
+	if len(events) > 0 && len(oss.notifyNames) > 0 {
+		if err := oss.notify(alertMessage(events, now)); err != nil {
+			utils.ErrorPrintln(err.Error(), false)
+		}
+	}
+}
+
+// evaluateAlerts evaluates rules against current data, updates and saves alert state.
+// It returns all alert states and the changes of this evaluation.
+func (oss *OSS) evaluateAlerts(now time.Time, rules []*alertRule) (map[string]*alertState, []*alertEvent, error) {
+	matches, failed, err := oss.matchAlerts(now, rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := lockAlertStates()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	states, err := loadAlertStates()
+	if err != nil {
+		return nil, nil, err
+	}
+	events := updateAlerts(states, matches, failed, now)
+	if err = saveAlertStates(states); err != nil {
+		return nil, nil, err
+	}
+	return states, events, nil
+}
+
+// matchAlerts fetches cds list, label members and disks needed by rules and evaluates rules.
+// It returns matches keyed by rule and target, and sn of cds whose disks could not be fetched.
+func (oss *OSS) matchAlerts(now time.Time, rules []*alertRule) (map[string]*alertMatch, map[string]bool, error) {
+	data, err := oss.listCDS()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var needLabels, needDisks bool
+	for _, r := range rules {
+		needLabels = needLabels || len(r.Scope.Labels) > 0
+		needDisks = needDisks || r.kind() == "disk"
+	}
+
+	var members map[string]map[string]bool
+	if needLabels {
+		if members, err = oss.labelSNs(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var diskMap map[string][]*disk
+	failed := make(map[string]bool)
+	if needDisks {
+		var diskCDS []*cdsInfo
+		for _, cds := range data.CDS {
+			for _, r := range rules {
+				if r.kind() == "disk" && r.inScope(cds, members) {
+					diskCDS = append(diskCDS, cds)
+					break
+				}
+			}
+		}
+		diskMap, failed = oss.fetchDisks(diskCDS)
+	}
+
+	matches := make(map[string]*alertMatch)
+	add := func(r *alertRule, cds *cdsInfo, target string, values alertValues) {
+		if !r.cond.match(values) {
+			return
+		}
+		matches[alertKey(r.Name, target)] = &alertMatch{
+			rule:    r,
+			target:  target,
+			kind:    r.kind(),
+			cdsSN:   cds.SN,
+			company: cds.Company,
+			value:   r.cond.formatValue(values),
+		}
+	}
+
+	for _, cds := range data.CDS {
+		values := cdsValues(cds, now, oss.settings.location)
+		for _, r := range rules {
+			if !r.inScope(cds, members) {
+				continue
+			}
+			switch r.kind() {
+			case "cds":
+				add(r, cds, cds.SN, values)
+			case "node":
+				for _, n := range cds.Nodes {
+					add(r, cds, cds.SN+"/"+n.SN, nodeValues(n))
+				}
+			case "disk":
+				for _, d := range diskMap[cds.SN] {
+					add(r, cds, cds.SN+"/"+d.Name, diskValues(d))
+				}
+			}
+		}
+	}
+	return matches, failed, nil
+}
+
+// labelSNs returns sn of cds of every label keyed by label name
+func (oss *OSS) labelSNs() (map[string]map[string]bool, error) {
+	labelList, err := oss.getLabels()
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]map[string]bool)
+	for _, l := range labelList.Labels {
+		list, err := oss.getCDSListByLabel(l.ID)
+		if err != nil {
+			return nil, err
+		}
+		if members[l.Name] == nil {
+			members[l.Name] = make(map[string]bool)
+		}
+		for _, cds := range list.CDS {
+			members[l.Name][cds.SN] = true
+		}
+	}
+	return members, nil
+}
+
+// fetchDisks fetches disks of cds concurrently, it returns disks keyed by sn and sn of cds failed to fetch
+func (oss *OSS) fetchDisks(cdsList []*cdsInfo) (map[string][]*disk, map[string]bool) {
+	wg := &sync.WaitGroup{}
+	mu := &sync.Mutex{}
+	in := make(chan string)
+	results := make(map[string][]*disk)
+	failed := make(map[string]bool)
+
+	for i := 0; i < oss.settings.Report.CDSWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sn := range in {
+				diskList, err := oss.getDisks(sn)
+				mu.Lock()
+				if err != nil {
+					oss.logger.Printf("get disks of %s failed %v", sn, err)
+					failed[sn] = true
+				} else {
+					results[sn] = diskList.Disk
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, cds := range cdsList {
+		in <- cds.SN
+	}
+	close(in)
+	wg.Wait()
+	return results, failed
+}
+
+// updateAlerts updates states by matches and returns changes. A matching alert is pending until the rule
+// matches for its duration, and resolved when it doesn't match. Disk alerts of cds in failed are kept as is.
+func updateAlerts(states map[string]*alertState, matches map[string]*alertMatch, failed map[string]bool, now time.Time) []*alertEvent {
+	var events []*alertEvent
+
+	for key, m := range matches {
+		st, ok := states[key]
+		if !ok || st.Status == "resolved" {
+			st = &alertState{
+				Rule:   m.rule.Name,
+				Target: m.target,
+				Kind:   m.kind,
+				CDSSN:  m.cdsSN,
+				Status: "pending",
+				Since:  now,
+			}
+			states[key] = st
+		}
+		st.Company, st.Severity, st.Value = m.company, m.rule.Severity, m.value
+
+		switch {
+		case st.Status == "pending" && now.Sub(st.Since) >= m.rule.forDuration:
+			st.Status, st.FiredAt, st.NotifiedAt = "firing", now, now
+			events = append(events, &alertEvent{kind: "firing", state: st})
+		case st.Status == "firing" && m.rule.repeat > 0 && now.Sub(st.NotifiedAt) >= m.rule.repeat:
+			st.NotifiedAt = now
+			events = append(events, &alertEvent{kind: "repeat", state: st})
+		}
+	}
+
+	for key, st := range states {
+		if _, ok := matches[key]; ok {
+			continue
+		}
+		if st.Kind == "disk" && failed[st.CDSSN] {
+			continue
+		}
+		switch st.Status {
+		case "pending":
+			delete(states, key)
+		case "firing":
+			st.Status, st.ResolvedAt = "resolved", now
+			events = append(events, &alertEvent{kind: "resolved", state: st})
+		case "resolved":
+			if now.Sub(st.ResolvedAt) > alertRetention {
+				delete(states, key)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i].state, events[j].state
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Target < b.Target
+	})
+	return events
+}
+
+// loadAlertRules loads alert rules from yaml file, fx_alerts.yaml in config dir is used if filename is empty
+func loadAlertRules(filename string) ([]*alertRule, error) {
+	if filename == "" {
+		filename = path.Join(confDir(), alertRulesYAML)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read alert rules %s failed: %v", filename, err)
+	}
+	rules := new(alertRules)
+	if err = yaml.UnmarshalStrict(b, rules); err != nil {
+		return nil, fmt.Errorf("yaml unmarshal alert rules %s failed %v", filename, err)
+	}
+	if len(rules.Rules) == 0 {
+		return nil, fmt.Errorf("no alert rule in %s", filename)
+	}
+
+	names := make(map[string]bool)
+	for _, r := range rules.Rules {
+		if err = r.setDefaults(); err != nil {
+			return nil, fmt.Errorf("invalid alert rules %s: %v", filename, err)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("invalid alert rules %s: duplicated rule %q", filename, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return rules.Rules, nil
+}
+
+// loadAlertStates loads alert states from config dir, it is empty if the file doesn't exist
+func loadAlertStates() (map[string]*alertState, error) {
+	filename := path.Join(confDir(), alertDir, alertStateJSON)
+	states := make(map[string]*alertState)
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read alert state %s failed: %v", filename, err)
+	}
+	if err = json.Unmarshal(b, &states); err != nil {
+		return nil, fmt.Errorf("json unmarshal alert state %s failed %v", filename, err)
+	}
+	return states, nil
+}
+
+// lockAlertStates creates a lock file beside alert state, so that concurrent checks and runs don't lose
+// updates of each other. It waits for the lock up to alertLockTimeout and returns a func to release it.
+func lockAlertStates() (func(), error) {
+	dir := path.Join(confDir(), alertDir)
+	if err := utils.CreateFolder(dir); err != nil {
+		return nil, err
+	}
+	filename := path.Join(dir, alertStateLock)
+	deadline := time.Now().Add(alertLockTimeout)
+	for {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(filename) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("lock alert state %s failed %v", filename, err)
+		}
+		if info, err := os.Stat(filename); err == nil && time.Since(info.ModTime()) > alertLockStale {
+			os.Remove(filename)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock alert state %s failed: it is locked by another fxoss", filename)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// saveAlertStates saves alert states into config dir
+func saveAlertStates(states map[string]*alertState) error {
+	dir := path.Join(confDir(), alertDir)
+	if err := utils.CreateFolder(dir); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal alert state failed %v", err)
+	}
+
+	// write a temporary file first so that the state is never half written
+	filename := path.Join(dir, alertStateJSON)
+	if err = ioutil.WriteFile(filename+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("write alert state %s failed %v", filename, err)
+	}
+	if err = os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("write alert state %s failed %v", filename, err)
+	}
+	return nil
+}
+
+func printAlertEvent(e *alertEvent, now time.Time) {
+	st := e.state
+	msg := fmt.Sprintf("%s [%s] %s %s %s %s value=%s", now.Format(time.RFC3339), st.Severity,
+		e.kind, st.Rule, st.Target, st.Company, st.Value)
+	if e.kind == "resolved" {
+		utils.SuccessPrintln(msg)
+		return
+	}
+	fmt.Println(severityText(msg, st.Severity))
+}
+
+// alertMessage makes a notification of alert events
+func alertMessage(events []*alertEvent, now time.Time) *notify.Message {
+	counts := make(map[string]int)
+	var lines []string
+	for _, e := range events {
+		st := e.state
+		counts[e.kind]++
+		lines = append(lines, fmt.Sprintf("- **[%s] %s** %s %s %s value=%s", st.Severity, e.kind, st.Rule, st.Target, st.Company, st.Value))
+	}
+	var summary []string
+	for _, kind := range []string{"firing", "repeat", "resolved"} {
+		if counts[kind] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	return &notify.Message{
+		Title: "fxoss alerts: " + strings.Join(summary, ", "),
+		Text:  strings.Join(lines, "\n"),
+		Time:  now,
+	}
+}
+
+// severityText colors text by severity
+func severityText(text, severity string) string {
+	c := utils.Blue
+	switch severity {
+	case "critical":
+		c = utils.Red
+	case "warning":
+		c = utils.Yellow
+	}
+	return utils.ColorText(text, c)
+}
+
+func sortAlertStates(states []*alertState) {
+	rank := map[string]int{"critical": 0, "warning": 1, "info": 2}
+	sort.Slice(states, func(i, j int) bool {
+		a, b := states[i], states[j]
+		if a.Status != b.Status {
+			return a.Status == "firing"
+		}
+		if a.Severity != b.Severity {
+			return rank[a.Severity] < rank[b.Severity]
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Target < b.Target
+	})
+}
+
+func alertKey(rule, target string) string {
+	return rule + "|" + target
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestLockAlertStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+	defer func(d time.Duration) { alertLockTimeout = d }(alertLockTimeout)
+	alertLockTimeout = 200 * time.Millisecond
+
+	unlock, err := lockAlertStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lockAlertStates(); err == nil {
+		t.Errorf("locked state should fail")
+	}
+	unlock()
+	if unlock, err = lockAlertStates(); err != nil {
+		t.Fatalf("unlocked state got %v", err)
+	}
+
+	// a lock left by a killed process is removed
+	stale := time.Now().Add(-2 * alertLockStale)
+	if err = os.Chtimes(path.Join(dir, alertDir, alertStateLock), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if unlock, err = lockAlertStates(); err != nil {
+		t.Fatalf("stale lock got %v", err)
+	}
+	unlock()
+}
@@ -9,17 +9,14 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"net/mail"
-	"net/smtp"
 	"os"
 	"path"
-	"sort"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/scorredoira/email"
 	"github.com/tealeg/xlsx"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
@@ -61,6 +58,10 @@ type OSS struct {
 	User, Password, Host, SSHUser, SSHPassword string
 	HTTPClient                                 *http.Client
 	logger                                     *log.Logger
+	settings                                   *settings
+	notifyNames                                []string
+	dryRun                                     bool
+	limiter                                    *utils.RateLimiter // limits requests to oss api
 	config
 }
 
@@ -85,6 +86,16 @@ func NewOssServer(now time.Time, config config, verbose bool) (*OSS, error) {
 		config:      config,
 	}
 
+	settings, err := oss.loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	if err = settings.check("api"); err != nil {
+		return nil, err
+	}
+	oss.settings = settings
+	oss.limiter = utils.NewRateLimiter(settings.API.RateLimit)
+
 	if _, err := os.Stat(tokenPath); os.IsNotExist(err) {
 		oss.logger.Printf("update now token from api")
 		if err = oss.updateToken(tokenPath); err != nil {
@@ -121,48 +132,36 @@ func NewOssServer(now time.Time, config config, verbose bool) (*OSS, error) {
 
 }
 
+// NewLocalServer creates an oss server for commands reading only local files, it doesn't need the api token
+func NewLocalServer(verbose bool) (*OSS, error) {
+	oss := &OSS{logger: logger.Mylogger(verbose)}
+	settings, err := oss.loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	oss.settings = settings
+	return oss, nil
+}
+
 // ShowCDSList shows all cds list info
-func (oss *OSS) ShowCDSList(option string, long bool) error {
-	// api doc: https://doc.fxdata.cn/jenkins/cloud/doc-api/build/#list-cds75
+func (oss *OSS) ShowCDSList(now time.Time, option string, long bool) error {
 
-	api := "/v1/cds"
-	errorMsg := "get cds list from api failed"
-	successMsg := "get cds list from api successfully"
-	data := new(cdsList)
 	var cdsList []*cdsInfo
 
 	var headers []string
 	var content [][]string
 
-	b, err := oss.get(api)
-
+	data, err := oss.getCDSList()
 	if err != nil {
-		utils.ErrorPrintln(errorMsg, false)
-		return fmt.Errorf("%s, %v", errorMsg, err)
-	}
-
-	if err = json.Unmarshal(b, &data); err != nil {
-		oss.logger.Printf("decode list failed %v", err)
-		utils.ErrorPrintln("decode cds list failed", false)
-		return fmt.Errorf("decode cds list failed, %v", err)
+		return err
 	}
 
-	utils.SuccessPrintln(successMsg)
 	if len(data.CDS) == 0 {
-		oss.logger.Printf("decode list failed %v", err)
 		utils.ColorPrintln("CDS list is empty", utils.Yellow)
 		return nil
 	}
 
-	if option == "" {
-		cdsList = data.CDS
-	} else {
-		for _, cds := range data.CDS {
-			if strings.Contains(cds.SN, option) || strings.Contains(cds.Company, option) {
-				cdsList = append(cdsList, cds)
-			}
-		}
-	}
+	cdsList = filterCDS(data.CDS, option)
 	if len(cdsList) == 0 {
 		utils.ColorPrintln("CDS list is empty", utils.Yellow)
 		return nil
@@ -182,6 +181,7 @@ func (oss *OSS) ShowCDSList(option string, long bool) error {
 			"monitor_kbps(max)",
 			"version",
 			"updated_at",
+			"last_seen",
 		}
 
 		for index, cds := range cdsList {
@@ -206,11 +206,12 @@ func (oss *OSS) ShowCDSList(option string, long bool) error {
 					cds.MonitorStr,
 					cds.Version,
 					cds.UpdatedAt,
+					lastSeen(cds.UpdatedAt, now, oss.settings.location),
 				})
 		}
 
 	} else {
-		headers = []string{"#", "company", "sn", "status", "version", "update_at"}
+		headers = []string{"#", "company", "sn", "status", "version", "update_at", "last_seen"}
 
 		for index, cds := range cdsList {
 			index++
@@ -221,6 +222,7 @@ func (oss *OSS) ShowCDSList(option string, long bool) error {
 				cds.Status,
 				cds.Version,
 				cds.UpdatedAt,
+				lastSeen(cds.UpdatedAt, now, oss.settings.location),
 			})
 
 		}
@@ -229,35 +231,33 @@ func (oss *OSS) ShowCDSList(option string, long bool) error {
 	return nil
 }
 
+// filterCDS returns cds whose sn or company contains option, all cds are returned if option is empty
+func filterCDS(cdsList []*cdsInfo, option string) []*cdsInfo {
+	if option == "" {
+		return cdsList
+	}
+	var results []*cdsInfo
+	for _, cds := range cdsList {
+		if strings.Contains(cds.SN, option) || strings.Contains(cds.Company, option) {
+			results = append(results, cds)
+		}
+	}
+	return results
+}
+
 // ShowNemList only shows all nem nodes which binded cds
 func (oss *OSS) ShowNemList() error {
-	// api doc http://doc.fxdata.cn/jenkins/cloud/nem-doc/build/#nem-node-list-pc-pc-nem
-	api := "/v1/nem/lite/nem_node/pc"
-	errorMsg := "get nem list from api failed"
-	successMsg := "get nem list from api successfully"
-
 	var nodes []*nemNode
-	var nodeList *nemNodeList
 
 	var headers []string
 	var content [][]string
 
-	b, err := oss.nemServerGet(api)
-
+	nodeList, err := oss.getNemNodes()
 	if err != nil {
-		utils.ErrorPrintln(errorMsg, false)
-		return fmt.Errorf("%s, %v", errorMsg, err)
-	}
-
-	if err = json.Unmarshal(b, &nodeList); err != nil {
-		oss.logger.Printf("decode nem list failed %v", err)
-		utils.ErrorPrintln("decode nem list failed", false)
-		return fmt.Errorf("decode nem list failed, %v", err)
+		return err
 	}
 
-	utils.SuccessPrintln(successMsg)
 	if len(nodeList.List) == 0 {
-		oss.logger.Printf("decode nem failed %v", err)
 		utils.ColorPrintln("nem list is empty", utils.Yellow)
 		return nil
 	}
@@ -378,7 +378,7 @@ func (oss *OSS) LoginCDS(sn, pwd string, retry, timeout int, f bool) error {
 		return fmt.Errorf("get ssh host port info failed: %v", err)
 	}
 
-	c, err := oss.sshClient(host, pwd, port, retry, timeout)
+	c, err := oss.sshClient(sn, host, pwd, port, retry, timeout)
 	if err != nil {
 		return err
 	}
@@ -419,52 +419,20 @@ func (oss *OSS) ShowCDSPort(sn string) error {
 	return nil
 }
 
-// ReportCDS generate a cds status xls report and sends the xls to gived to list
-func (oss *OSS) ReportCDS(now time.Time, toList ...string) error {
-
-	root := confDir()
-	excelName := utils.GenerateExcelName(now)
-	excelPath := path.Join(root, excelName)
-	toUsers := strings.Join(toList, ",")
-
-	defer func() {
-		fileName := path.Join(root, excelName)
-		err := os.Remove(fileName)
-		if err == nil {
-			oss.logger.Printf("delet file %s success", fileName)
+// ReportCDS generates a cds disk type report of opts.Format, the report is sent to toList with a summary
+// and removed, or it is kept without email at opts.Output or in the config dir if opts.NoEmail is true.
+// A snapshot is saved after the report is sent.
+func (oss *OSS) ReportCDS(now time.Time, opts ReportOptions, toList ...string) error {
+	// save a snapshot for `fxoss snapshot diff`, dry runs don't crawl labels and ports again
+	opts.sent = func() {
+		if filename, err := oss.saveSnapshot(now); err != nil {
+			oss.logger.Printf("save snapshot failed %v", err)
+			utils.ErrorPrintln("保存快照失败", false)
+		} else {
+			utils.SuccessPrintln("保存快照成功: " + filename)
 		}
-	}()
-
-	utils.ColorPrintln("开始提取数据", utils.Yellow)
-
-	in := make(chan *label)      // without cds list information
-	out := make(chan *label, 20) // with cds information
-
-	go oss.fetchCDSByLabel(in, out)
-	go oss.fetchLabels(in)
-	data := oss.fetchDiskTypeResult(out)
-
-	utils.ColorPrintln("开始创建表格: "+excelName, utils.Yellow)
-
-	err := oss.makeCDSExcel(data, excelPath)
-	if err != nil {
-		oss.logger.Println(err)
-		utils.ErrorPrintln(fmt.Sprintf("创建excel%s失败", excelName), false)
-		return nil
-	}
-
-	utils.ColorPrintln("开始发送邮件给: "+toUsers, utils.Yellow)
-
-	err = oss.sendEmail(excelName, "cds 磁盘情况报告", toList...)
-	if err != nil {
-		utils.ErrorPrintln(fmt.Sprintf("发送email%s给%q失败", excelName, toUsers), false)
-		oss.logger.Println(err)
 	}
-
-	utils.SuccessPrintln("发送邮件成至用户:" + toUsers)
-
-	return nil
-
+	return oss.runReport(now, reportKinds[diskTypeReport], opts, toList...)
 }
 
 // WebRoot show cds web root token
@@ -473,25 +441,19 @@ func (oss *OSS) WebRoot(sn string) error {
 	return nil
 }
 
-func (oss *OSS) fetchLabels(in chan<- *label) error {
+// fetchLabels sends labels to in, a failure is counted in failures
+func (oss *OSS) fetchLabels(in chan<- *label, failures *fetchFailures) error {
 	defer func() {
 		close(in)
 		oss.logger.Printf("finished job fetchLabels and close chan in")
 	}()
-	api := "/v1/cds-labels"
-	labelList := new(labels)
-	data, err := oss.get(api)
-
+	labelList, err := oss.getLabels()
+	failures.add(stageLabels, "", nil, err)
 	if err != nil {
 		oss.logger.Printf("%v", err)
 		utils.ErrorPrintln("获取cds-lables信息失败", false)
 		return err
 	}
-	if err = json.Unmarshal(data, labelList); err != nil {
-		oss.logger.Printf("json.Unmarshal cds labels failed %v", err)
-		utils.ErrorPrintln("解析cds labels信息失败", false)
-		return fmt.Errorf("json.Ummarshal cds-labels failed %v", err)
-	}
 	if len(labelList.Labels) == 0 {
 		oss.logger.Println("cds labels is empty, pass")
 		return nil
@@ -502,30 +464,25 @@ func (oss *OSS) fetchLabels(in chan<- *label) error {
 	return nil
 }
 
-func (oss *OSS) fetchCDSByLabel(in <-chan *label, out chan<- *label) {
+// fetchCDSByLabel fetches cds of labels from in by report label workers, failures are counted
+// in failures and labels whose cds could not be fetched are not sent to out
+func (oss *OSS) fetchCDSByLabel(in <-chan *label, out chan<- *label, failures *fetchFailures) {
 	wg := &sync.WaitGroup{}
-	apiBase := "/v1/cds?label=%d"
 
 	defer func() {
 		oss.logger.Printf("oss.fetchCdsByLabel finished jobs")
 		close(out)
 	}()
 
-	for i := 0; i < 5; i++ {
+	for i := 0; i < oss.settings.Report.LabelWorkers; i++ {
 		wg.Add(1)
 		go func(in <-chan *label) {
 			defer wg.Done()
 			for label := range in {
-				api := fmt.Sprintf(apiBase, label.ID)
-				list := new(cdsList)
-				oss.logger.Printf("api %s", api)
-				b, err := oss.get(api)
+				list, err := oss.getCDSListByLabel(label.ID)
+				failures.add(stageCDSList, label.Name, nil, err)
 				if err != nil {
-					oss.logger.Printf("get cds info from api %s failed %v", api, err)
-					continue
-				}
-				if err = json.Unmarshal(b, list); err != nil {
-					oss.logger.Printf("unmarshal cds info failed %v", err)
+					oss.logger.Printf("%v", err)
 					continue
 				}
 				label.CDSList = list.CDS
@@ -537,7 +494,9 @@ func (oss *OSS) fetchCDSByLabel(in <-chan *label, out chan<- *label) {
 	return
 }
 
-func (oss *OSS) fetchDiskTypeResult(labels <-chan *label) map[string][]*diskTypeResult {
+// fetchDiskTypeResult makes a result of every cds of labels, fetch is called for every result
+// in the worker pool to fetch data of the cds if it is not nil, and its errors are counted in failures.
+func (oss *OSS) fetchDiskTypeResult(labels <-chan *label, fetch func(oss *OSS, r *diskTypeResult) error, failures *fetchFailures) map[string][]*diskTypeResult {
 
 	wg := &sync.WaitGroup{}
 	mapping := make(map[string][]*diskTypeResult)
@@ -554,15 +513,16 @@ func (oss *OSS) fetchDiskTypeResult(labels <-chan *label) map[string][]*diskType
 		semaphore <- struct{}{}
 	}()
 
-	// start diskType and UserAndSppeedFormat
+	// start diskType
 	oss.logger.Printf("fetch disk type result start work")
-	for i := 0; i < 10; i++ {
+	for i := 0; i < oss.settings.Report.CDSWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for ret := range in {
-				ret.diskType = oss.getDiskType(ret.sn)
-				ret.userAndSpeed = utils.FormatUserAndSpeed(ret.user, ret.speed)
+				if fetch != nil {
+					failures.add(stageCDS, ret.domain, ret.cds, fetch(oss, ret))
+				}
 				out <- ret
 			}
 			return
@@ -573,7 +533,7 @@ func (oss *OSS) fetchDiskTypeResult(labels <-chan *label) map[string][]*diskType
 		oss.logger.Printf("fetchDiskTypeResult get label %v", l.Name)
 
 		for _, c := range l.CDSList {
-			d := diskTypeResult{domain: l.Name, sn: c.SN, company: c.Company, status: c.Status, user: c.OnlineUserMax, speed: c.ServiceKbpsMax}
+			d := diskTypeResult{domain: l.Name, sn: c.SN, company: c.Company, status: c.Status, user: c.OnlineUserMax, speed: c.ServiceKbpsMax, cds: c}
 			in <- &d
 		}
 	}
@@ -589,48 +549,70 @@ func (oss *OSS) fetchDiskTypeResult(labels <-chan *label) map[string][]*diskType
 	return mapping
 }
 
-func (oss *OSS) getDiskType(sn string) int64 {
+// getDiskType calculates disk type of cds by total size of its disks,
+// an error is returned if the cds has no disk or any disk size is unknown.
+func (oss *OSS) getDiskType(sn string) (diskType int64, size float64, err error) {
+	if err = oss.settings.check("disk_tiers"); err != nil {
+		return 0, 0, err
+	}
+	diskList, err := oss.getDisks(sn)
+	if err != nil {
+		oss.logger.Printf("%v", err)
+		return 0, 0, err
+	}
+	if len(diskList.Disk) == 0 {
+		return 0, 0, fmt.Errorf("cds %s has no disk", sn)
+	}
+
+	for _, d := range diskList.Disk {
+		s, err := utils.ParseSize(d.Size)
+		if err != nil {
+			oss.logger.Printf("cds %s disk %s: %v", sn, d.Name, err)
+			return 0, 0, fmt.Errorf("disk %s: %v", d.Name, err)
+		}
+		size += s
+	}
+
+	return utils.CalcDiskTier(size, oss.settings.diskTiers), size, nil
+}
+
+// getDisks gets disk list of cds
+func (oss *OSS) getDisks(sn string) (*disks, error) {
 	api := fmt.Sprintf("/v1/icaches/%s/disks", sn)
-	// oss.logger.Printf("fetch disk type by sn %s", sn)
 	data, err := oss.get(api)
 	if err != nil {
-		oss.logger.Printf("fetch api %s failed %v, return 0", api, err)
-		return 0
+		return nil, fmt.Errorf("fetch api %s failed %v", api, err)
 	}
 	diskList := new(disks)
 	err = json.Unmarshal(data, &diskList)
 	if err != nil {
-		oss.logger.Printf("parser disk list failed %v, return 0", err)
-		return 0
+		return nil, fmt.Errorf("parser disk list failed %v", err)
 	}
-
-	return utils.CalcDiskType(int64(len(diskList.Disk)))
+	return diskList, nil
 }
 
-func (oss *OSS) sendEmail(filename, msg string, toList ...string) error {
+// sendEmail sends the report summary and the attachment reportPath to toList
+func (oss *OSS) sendEmail(reportPath string, summary *reportSummary, opts ReportOptions, toList ...string) error {
 
-	dirname := confDir()
 	conf, err := oss.loadEmailConfig()
 	if err != nil {
 		return err
 	}
 
-	attachFilePath := path.Join(dirname, filename)
-	data, err := ioutil.ReadFile(attachFilePath)
+	data, err := ioutil.ReadFile(reportPath)
 	if err != nil {
-		return fmt.Errorf("read xlsx: %s failed %v", filename, err)
+		return fmt.Errorf("read report: %s failed %v", reportPath, err)
 	}
-	m := email.NewMessage("FxData CDS message", msg)
-	m.From = mail.Address{Name: fmt.Sprintf("Operation Robot <%s>", conf.Address), Address: conf.Address}
-	m.To = toList
-	m.AttachBuffer(filename, data, false)
-
-	auth := smtp.PlainAuth("", conf.Address, conf.Password, conf.SMTPServer)
+	summary.Env = oss.reportEnv(conf)
+	m, err := newReportMessage(conf, summary, opts, toList)
+	if err != nil {
+		return err
+	}
+	m.AttachBuffer(filepath.Base(reportPath), data, false)
 
-	if err = email.Send("smtp.exmail.qq.com:25", auth, m); err != nil {
-		oss.logger.Printf("send mail failed: %v", err)
+	if err = oss.deliverEmail(conf, m); err != nil {
 		utils.ErrorPrintln("发送邮件失败", false)
-		return fmt.Errorf("send mail failed %v", err)
+		return err
 	}
 	return nil
 }
@@ -638,9 +620,7 @@ func (oss *OSS) sendEmail(filename, msg string, toList ...string) error {
 // loadEmailConfig load email config from config
 func (oss *OSS) loadEmailConfig() (*emailConf, error) {
 
-	name := "fx_email.json"
-	dir := confDir()
-	filename := path.Join(dir, name)
+	filename := path.Join(confDir(), emailJSON)
 
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		oss.logger.Printf("file %s doesn't exists", filename)
@@ -648,18 +628,14 @@ func (oss *OSS) loadEmailConfig() (*emailConf, error) {
 		return nil, fmt.Errorf("no found email config %s", filename)
 	}
 
-	b, err := ioutil.ReadFile(filename)
+	conf, err := readEmailConfig(filename)
 	if err != nil {
-		oss.logger.Printf("read email config failed %v", err)
+		oss.logger.Printf("%v", err)
 		utils.ErrorPrintln(fmt.Sprintf("读取%s失败", filename), false)
-		return nil, fmt.Errorf("read email config failed: %v", err)
+		return nil, err
 	}
-
-	conf := new(emailConf)
-	err = json.Unmarshal(b, conf)
-	if err != nil {
-		oss.logger.Printf("json unmarshal email failed %v", err)
-		return nil, fmt.Errorf("json unmarshal failed %v", err)
+	if err = conf.setDefaults(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
 	}
 	return conf, nil
 }
@@ -676,11 +652,99 @@ func (oss *OSS) getCDSPort(sn string) (*portInfo, error) {
 	}
 
 	if err = json.Unmarshal(b, &port); err != nil {
-		err = fmt.Errorf("unmarshal cds port info failed, %v", err)
+		return nil, fmt.Errorf("unmarshal cds port info failed, %v", err)
 	}
 	return port, nil
 }
 
+// getCDSList gets all cds information from api
+func (oss *OSS) getCDSList() (*cdsList, error) {
+	errorMsg := "get cds list from api failed"
+	successMsg := "get cds list from api successfully"
+
+	data, err := oss.listCDS()
+	if err != nil {
+		utils.ErrorPrintln(errorMsg, false)
+		return nil, fmt.Errorf("%s, %v", errorMsg, err)
+	}
+
+	utils.SuccessPrintln(successMsg)
+	return data, nil
+}
+
+// listCDS gets all cds information from api without printing messages
+func (oss *OSS) listCDS() (*cdsList, error) {
+	// api doc: https://doc.fxdata.cn/jenkins/cloud/doc-api/build/#list-cds75
+	api := "/v1/cds"
+	data := new(cdsList)
+
+	b, err := oss.get(api)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &data); err != nil {
+		oss.logger.Printf("decode list failed %v", err)
+		return nil, fmt.Errorf("decode cds list failed, %v", err)
+	}
+	return data, nil
+}
+
+// getLabels gets all cds labels from api
+func (oss *OSS) getLabels() (*labels, error) {
+	api := "/v1/cds-labels"
+	labelList := new(labels)
+
+	data, err := oss.get(api)
+	if err != nil {
+		return nil, fmt.Errorf("get cds labels failed %v", err)
+	}
+	if err = json.Unmarshal(data, labelList); err != nil {
+		return nil, fmt.Errorf("json.Ummarshal cds-labels failed %v", err)
+	}
+	return labelList, nil
+}
+
+// getCDSListByLabel gets cds list of the label
+func (oss *OSS) getCDSListByLabel(id int64) (*cdsList, error) {
+	api := fmt.Sprintf("/v1/cds?label=%d", id)
+	list := new(cdsList)
+	oss.logger.Printf("api %s", api)
+	b, err := oss.get(api)
+	if err != nil {
+		return nil, fmt.Errorf("get cds info from api %s failed %v", api, err)
+	}
+	if err = json.Unmarshal(b, list); err != nil {
+		return nil, fmt.Errorf("unmarshal cds info failed %v", err)
+	}
+	return list, nil
+}
+
+// getNemNodes gets nem node list from nem server
+func (oss *OSS) getNemNodes() (*nemNodeList, error) {
+	// api doc http://doc.fxdata.cn/jenkins/cloud/nem-doc/build/#nem-node-list-pc-pc-nem
+	api := "/v1/nem/lite/nem_node/pc"
+	errorMsg := "get nem list from api failed"
+	successMsg := "get nem list from api successfully"
+	nodeList := new(nemNodeList)
+
+	b, err := oss.nemServerGet(api)
+
+	if err != nil {
+		utils.ErrorPrintln(errorMsg, false)
+		return nil, fmt.Errorf("%s, %v", errorMsg, err)
+	}
+
+	if err = json.Unmarshal(b, &nodeList); err != nil {
+		oss.logger.Printf("decode nem list failed %v", err)
+		utils.ErrorPrintln("decode nem list failed", false)
+		return nil, fmt.Errorf("decode nem list failed, %v", err)
+	}
+
+	utils.SuccessPrintln(successMsg)
+	return nodeList, nil
+}
+
 // getCDSDetail gets CDS detail infomation
 func (oss *OSS) getCDSDetail(sn string) (detail *cdsDetail, err error) {
 
@@ -748,6 +812,7 @@ func (oss *OSS) get(api string) ([]byte, error) {
 	req.Header.Set("X-auth-token", oss.GetToken())
 	req.Header.Set("Content-Type", "application/json")
 
+	oss.limiter.Wait()
 	resp, err := oss.HTTPClient.Do(req)
 
 	if err != nil {
@@ -776,6 +841,7 @@ func (oss *OSS) nemServerGet(api string) ([]byte, error) {
 	req.Header.Set("X-auth-token", oss.GetToken())
 	req.Header.Set("Content-Type", "application/json")
 
+	oss.limiter.Wait()
 	resp, err := oss.HTTPClient.Do(req)
 
 	if err != nil {
@@ -846,6 +912,17 @@ func (oss *OSS) updateToken(fileName string) error {
 	return nil
 }
 
+// ensureToken updates token if it is expired, it is used by long running commands
+func (oss *OSS) ensureToken(now time.Time) {
+	if oss.IsValid(oss.Host, now) {
+		return
+	}
+	oss.logger.Printf("config is invalid update...")
+	if err := oss.updateToken(path.Join(confDir(), tokenJSON)); err != nil {
+		oss.logger.Printf("update token failed %v", err)
+	}
+}
+
 func (oss *OSS) getNewToken() ([]byte, error) {
 	api := "/v1/auth/tokens"
 
@@ -859,7 +936,8 @@ func (oss *OSS) getNewToken() ([]byte, error) {
 	return oss.post(api, body, false)
 }
 
-func (oss *OSS) sshClient(host, pwd string, port, retry, timeout int) (*ssh.Client, error) {
+// sshClient connects cds sn at host:port, its host key is verified by known hosts of fxoss
+func (oss *OSS) sshClient(sn, host, pwd string, port, retry, timeout int) (*ssh.Client, error) {
 	tDuration := time.Duration(0)
 	Cb := func(user, instruction string, questions []string, echos []bool) ([]string, error) {
 		answers := make([]string, len(questions))
@@ -884,15 +962,24 @@ func (oss *OSS) sshClient(host, pwd string, port, retry, timeout int) (*ssh.Clie
 	} else {
 		tDuration = time.Duration(timeout) * time.Second
 	}
+	hosts, err := loadKnownHosts()
+	if err != nil {
+		return nil, err
+	}
+	var learned *knownHost
 	sshConfig := &ssh.ClientConfig{
 		User: oss.SSHUser,
 		Auth: []ssh.AuthMethod{
 			ssh.Password(pwd),
 			ssh.RetryableAuthMethod(ssh.KeyboardInteractive(Cb), retry),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback(sn, hosts, &learned, oss.settings.location),
 		Timeout:         tDuration,
 	}
+	if h, ok := hosts[sn]; ok {
+		// ask for the known key, a cds with several host keys offers the one preferred by the library
+		sshConfig.HostKeyAlgorithms = h.algorithms()
+	}
 
 	addr := fmt.Sprintf("%s:%d", host, port)
 	client, err := ssh.Dial("tcp", addr, sshConfig)
@@ -900,6 +987,16 @@ func (oss *OSS) sshClient(host, pwd string, port, retry, timeout int) (*ssh.Clie
 	if err != nil {
 		return nil, fmt.Errorf("ssh dail: connection failed %s", err)
 	}
+
+	if learned != nil {
+		hosts[sn] = learned
+		if err = hosts.save(); err != nil {
+			oss.logger.Printf("save host key of %s failed %v", sn, err)
+			utils.ErrorPrintln("保存主机密钥失败", false)
+		} else {
+			utils.ColorPrintln(fmt.Sprintf("首次连接cds %s, 已信任主机密钥 %s %s", sn, learned.Type, learned.fingerprint()), utils.Yellow)
+		}
+	}
 	return client, nil
 
 }
@@ -923,58 +1020,6 @@ func confDir() string {
 	return dirname
 }
 
-func (oss *OSS) makeCDSExcel(data map[string][]*diskTypeResult, xlsxPath string) error {
-	headers := []string{"Customer Name", "SN", "Service Max Speed", "Status", "Device Type"}
-
-	var file *xlsx.File
-	var sheet *xlsx.Sheet
-	var row *xlsx.Row
-	var cell *xlsx.Cell
-	var err error
-	var rowData []string
-
-	keys := make([]string, 0, len(data))
-	for key := range data {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	// Create new excel file
-	file = xlsx.NewFile()
-	hStyle := headerStyle()
-
-	for _, key := range keys {
-		sheet, err = file.AddSheet(key)
-
-		if err != nil {
-			return fmt.Errorf("create new sheet %s %v", key, err)
-		}
-
-		row = sheet.AddRow()
-		for _, item := range headers {
-			cell = row.AddCell()
-			cell.SetStyle(hStyle)
-			cell.Value = item
-		}
-
-		d := data[key]
-
-		sort.Slice(d[:], func(i, j int) bool { return d[i].sn < d[j].sn })
-		for _, item := range d {
-			rowData = []string{item.company, item.sn, item.userAndSpeed, item.status, strconv.Itoa(int(item.diskType))}
-			row = sheet.AddRow()
-			row.WriteSlice(&rowData, 5)
-		}
-	}
-
-	// save
-	err = file.Save(xlsxPath)
-	if err != nil {
-		return fmt.Errorf("save excel file %s %v", xlsxPath, err)
-	}
-	return nil
-}
-
 func headerStyle() *xlsx.Style {
 
 	style := xlsx.NewStyle()
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+const (
+	// reportArchiveDir keeps sent reports and their data in a directory of every day
+	reportArchiveDir    = "reports"
+	reportArchiveLayout = "2006-01-02"
+	compareSheet        = "Comparison"
+)
+
+var compareHeaders = []string{"Label", "Change", "SN", "Customer Name", "Before", "After", "Delta"}
+
+// archivedResult is a diskTypeResult kept in the report archive
+type archivedResult struct {
+	SN        string  `json:"sn"`
+	Company   string  `json:"company"`
+	Status    string  `json:"status"`
+	Users     int64   `json:"users"`
+	SpeedKbps int64   `json:"speed_kbps"`
+	DiskType  int64   `json:"disk_type"`
+	DiskSize  float64 `json:"disk_size"`
+	DiskErr   string  `json:"disk_error,omitempty"`
+}
+
+// reportArchive is the data of a sent report, results are keyed by label name
+type reportArchive struct {
+	Report   string                       `json:"report"`
+	Time     time.Time                    `json:"time"`
+	File     string                       `json:"file"`
+	Failures int                          `json:"failures"`
+	Labels   map[string][]*archivedResult `json:"labels"`
+}
+
+func newReportArchive(kind string, now time.Time, file string, d *reportData) *reportArchive {
+	failed, _ := d.failures.count()
+	a := &reportArchive{Report: kind, Time: now, File: file, Failures: failed, Labels: make(map[string][]*archivedResult)}
+	for name, results := range d.labels {
+		list := []*archivedResult{}
+		for _, r := range sortedResults(results) {
+			ar := &archivedResult{SN: r.sn, Company: r.company, Status: r.status, Users: r.user, SpeedKbps: r.speed, DiskType: r.diskType, DiskSize: r.diskSize}
+			if r.diskErr != nil {
+				ar.DiskErr = r.diskErr.Error()
+			}
+			list = append(list, ar)
+		}
+		a.Labels[name] = list
+	}
+	return a
+}
+
+// results converts the archive back to results of labels
+func (a *reportArchive) results() map[string][]*diskTypeResult {
+	data := make(map[string][]*diskTypeResult)
+	for name, list := range a.Labels {
+		results := []*diskTypeResult{}
+		for _, ar := range list {
+			r := &diskTypeResult{domain: name, sn: ar.SN, company: ar.Company, status: ar.Status, user: ar.Users, speed: ar.SpeedKbps, diskType: ar.DiskType, diskSize: ar.DiskSize}
+			if ar.DiskErr != "" {
+				r.diskErr = errors.New(ar.DiskErr)
+			}
+			results = append(results, r)
+		}
+		data[name] = results
+	}
+	return data
+}
+
+// reportArchivePath returns the archive directory of the day of now in l
+func reportArchivePath(now time.Time, l *time.Location) string {
+	return path.Join(confDir(), reportArchiveDir, now.In(l).Format(reportArchiveLayout))
+}
+
+// archiveReport moves the sent report file into the directory of its day in l as a.File and saves its data,
+// the file name has the time of the run so later reports of the same day don't overwrite it.
+func archiveReport(reportPath string, a *reportArchive, l *time.Location) error {
+	dir := reportArchivePath(a.Time, l)
+	if err := utils.CreateFolder(dir); err != nil {
+		return err
+	}
+	filename := path.Join(dir, a.File)
+	if err := os.Rename(reportPath, filename); err != nil {
+		return fmt.Errorf("move report to %s failed %v", filename, err)
+	}
+	return saveReportArchive(a, l)
+}
+
+// saveReportArchive writes the data of a report as <report>.json into the directory of its day in l,
+// it is the data of the last report of the day
+func saveReportArchive(a *reportArchive, l *time.Location) error {
+	dir := reportArchivePath(a.Time, l)
+	if err := utils.CreateFolder(dir); err != nil {
+		return err
+	}
+	filename := path.Join(dir, a.Report+".json")
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal report archive failed %v", err)
+	}
+	if err = ioutil.WriteFile(filename+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("write %s failed %v", filename, err)
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// archiveDays returns names of day directories of the archive sorted by date
+func archiveDays() ([]string, error) {
+	infos, err := ioutil.ReadDir(path.Join(confDir(), reportArchiveDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read report archive failed %v", err)
+	}
+	var days []string
+	for _, info := range infos {
+		if _, err := time.Parse(reportArchiveLayout, info.Name()); err == nil && info.IsDir() {
+			days = append(days, info.Name())
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// loadPreviousArchive loads the latest archive of report before now, archives with failed
+// fetches are skipped since their devices are incomplete. It returns nil if there is none.
+func loadPreviousArchive(report string, now time.Time) (*reportArchive, error) {
+	days, err := archiveDays()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(days) - 1; i >= 0; i-- {
+		filename := path.Join(confDir(), reportArchiveDir, days[i], report+".json")
+		b, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed %v", filename, err)
+		}
+		a := new(reportArchive)
+		if err = json.Unmarshal(b, a); err != nil {
+			return nil, fmt.Errorf("unmarshal %s failed %v", filename, err)
+		}
+		if a.Failures == 0 && a.Time.Before(now) {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// pruneReportArchive removes day directories of the archive older than retention, days are in l
+func pruneReportArchive(now time.Time, retention time.Duration, l *time.Location) ([]string, error) {
+	days, err := archiveDays()
+	if err != nil {
+		return nil, err
+	}
+	oldest := now.Add(-retention).In(l).Format(reportArchiveLayout)
+	var removed []string
+	for _, day := range days {
+		if day >= oldest {
+			break
+		}
+		if err = os.RemoveAll(path.Join(confDir(), reportArchiveDir, day)); err != nil {
+			return removed, fmt.Errorf("remove report archive %s failed %v", day, err)
+		}
+		removed = append(removed, day)
+	}
+	return removed, nil
+}
+
+// comparisonSheet compares results of labels with the previous report: new and removed devices,
+// tier changes and bandwidth of every label
+func comparisonSheet(before, after map[string][]*diskTypeResult) *reportSheet {
+	sheet := &reportSheet{Name: compareSheet, Headers: compareHeaders}
+	names := sortedLabels(after)
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		old := make(map[string]*diskTypeResult)
+		var speedBefore, speedAfter int64
+		for _, r := range before[name] {
+			old[r.sn] = r
+			speedBefore += r.speed
+		}
+		var rows [][]interface{}
+		for _, r := range sortedResults(after[name]) {
+			speedAfter += r.speed
+			tier, _ := r.diskText()
+			o, ok := old[r.sn]
+			delete(old, r.sn)
+			if !ok {
+				rows = append(rows, []interface{}{name, "new", r.sn, r.company, nil, tier, nil})
+				continue
+			}
+			// unknown means disks could not be fetched, it is not a change of tier
+			if oldTier, _ := o.diskText(); oldTier != tier && o.diskErr == nil && r.diskErr == nil {
+				rows = append(rows, []interface{}{name, "tier", r.sn, r.company, o.diskType, r.diskType, r.diskType - o.diskType})
+			}
+		}
+		for _, r := range sortedResults(before[name]) {
+			if _, ok := old[r.sn]; ok {
+				tier, _ := r.diskText()
+				rows = append(rows, []interface{}{name, "removed", r.sn, r.company, tier, nil, nil})
+			}
+		}
+		rows = append(rows, []interface{}{name, "bandwidth", nil, nil, kbpsToMbps(speedBefore), kbpsToMbps(speedAfter), kbpsToMbps(speedAfter - speedBefore)})
+		sheet.Rows = append(sheet.Rows, rows...)
+	}
+	return sheet
+}
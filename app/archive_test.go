@@ -0,0 +1,127 @@
+package app
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	now := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	cst := time.FixedZone("CST", 8*3600)
+	if a, err := loadPreviousArchive(diskTypeReport, now); a != nil || err != nil {
+		t.Errorf("empty archive got %v %v", a, err)
+	}
+
+	d := &reportData{now: now, labels: reportTestData(), failures: new(fetchFailures)}
+	for i, day := range []int{-100, -14, -7} {
+		a := newReportArchive(diskTypeReport, now.AddDate(0, 0, day), "cds.xlsx", d)
+		if i == 2 {
+			a.Failures = 1 // skipped
+		}
+		if err = saveReportArchive(a, cst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := loadPreviousArchive(diskTypeReport, now)
+	if err != nil || a == nil || !a.Time.Equal(now.AddDate(0, 0, -14)) {
+		t.Fatalf("got previous %v %v", a, err)
+	}
+	results := a.results()
+	if r := results["江苏"][1]; r.sn != "CAS0530000300" || r.diskErr == nil || r.diskErr.Error() != "timeout" || r.speed != 512 {
+		t.Errorf("got result %+v", r)
+	}
+	if r := results["南京"][0]; r.diskType != 1000 || r.diskErr != nil || r.domain != "南京" {
+		t.Errorf("got result %+v", r)
+	}
+	if a, _ := loadPreviousArchive("traffic", now); a != nil {
+		t.Errorf("archive of other report got %v", a)
+	}
+
+	removed, err := pruneReportArchive(now, 90*24*time.Hour, cst)
+	if err != nil || strings.Join(removed, ",") != "2026-07-11" {
+		t.Errorf("got removed %v %v", removed, err)
+	}
+	if days, _ := archiveDays(); strings.Join(days, ",") != "2026-10-05,2026-10-12" {
+		t.Errorf("got days %v", days)
+	}
+}
+
+func TestArchiveReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	d := &reportData{labels: reportTestData(), failures: new(fetchFailures)}
+	now := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	cst := time.FixedZone("CST", 8*3600)
+	// two runs of the same day keep their own files
+	for i, file := range []string{"cds-090000.xlsx", "cds-100000.xlsx"} {
+		report := path.Join(dir, "cds.xlsx")
+		if err = ioutil.WriteFile(report, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = archiveReport(report, newReportArchive(diskTypeReport, now.Add(time.Duration(i)*time.Hour), file, d), cst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"cds-090000.xlsx", "cds-100000.xlsx"} {
+		if b, err := ioutil.ReadFile(path.Join(reportArchivePath(now, cst), file)); err != nil || string(b) != file {
+			t.Errorf("archived %s got %q %v", file, b, err)
+		}
+	}
+	if a, _ := loadPreviousArchive(diskTypeReport, now.Add(2*time.Hour)); a == nil || a.File != "cds-100000.xlsx" {
+		t.Errorf("got previous %+v", a)
+	}
+}
+
+func TestComparisonSheet(t *testing.T) {
+	before := reportTestData()
+	after := map[string][]*diskTypeResult{
+		"南京": {
+			{domain: "南京", sn: "CAS0530000102", company: "南京农业大学", speed: 4096, diskType: 2000},
+			{domain: "南京", sn: "CAS0530000400", company: "东南大学", speed: 1024, diskType: 500},
+		},
+		"江苏": {
+			{domain: "江苏", sn: "CAS0530000102", company: "南京农业大学", speed: 4096, diskType: 2000},
+			{domain: "江苏", sn: "CAS0530000300", company: "苏州大学", speed: 512, diskType: 500},
+		},
+		"上海": {
+			{domain: "上海", sn: "CAS0530000500", company: "复旦大学", diskErr: errors.New("timeout")},
+		},
+	}
+	var got []string
+	for _, row := range comparisonSheet(before, after).Rows {
+		got = append(got, strings.Join(rowText(row), ","))
+	}
+	want := []string{
+		"上海,new,CAS0530000500,复旦大学,,unknown,",
+		"上海,bandwidth,,,0,0,0",
+		"南京,tier,CAS0530000102,南京农业大学,1000,2000,1000",
+		"南京,new,CAS0530000400,东南大学,,500,",
+		"南京,removed,CAS0530000231,南京航空航天大学,500,,",
+		"南京,bandwidth,,,3,5,2",
+		"江苏,tier,CAS0530000102,南京农业大学,1000,2000,1000",
+		"江苏,bandwidth,,,2.5,4.5,2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got rows\n%s\n!= want\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
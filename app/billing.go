@@ -0,0 +1,249 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tealeg/xlsx"
+
+	"github.com/super1-chen/fxoss/history"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var billingHeaders = []string{"p95(Mbps)", "peak(Mbps)", "avg(Mbps)", "samples", "coverage"}
+
+// ShowBilling shows 95th-percentile, peak and average service bandwidth per company and per cds
+// of the month (formatted as 2006-01, default last month) from local history, results are saved as xlsx
+// if output is given.
+func (oss *OSS) ShowBilling(now time.Time, month, output string) error {
+	if month == "" {
+		month = lastMonth(now, oss.settings.location)
+	}
+	start, end, err := monthRange(month, oss.settings.location)
+	if err != nil {
+		return err
+	}
+
+	store, err := oss.historyStore()
+	if err != nil {
+		return err
+	}
+	samples, err := store.Query(start, end.Add(-time.Second), func(s *history.Sample) bool { return s.Kind == "cds" })
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("History of %s is empty, run `fxoss collect` first", month), utils.Yellow)
+		return nil
+	}
+
+	companies := make(map[string]string)
+	if data, err := oss.getCDSList(); err == nil {
+		for _, cds := range data.CDS {
+			companies[cds.SN] = cds.Company
+		}
+	}
+
+	companyResults, cdsResults := billingResults(samples, companies, oss.settings.History.interval, end.Sub(start))
+
+	utils.SuccessPrintln(fmt.Sprintf("%s 带宽计费 (95th percentile)", month))
+	companyHeaders := append([]string{"#", "company", "cds"}, billingHeaders...)
+	var content [][]string
+	for index, ret := range companyResults {
+		index++
+		content = append(content, append([]string{strconv.Itoa(index), ret.company, strconv.Itoa(ret.cdsCount)}, billingRow(ret)...))
+	}
+	utils.PrintTable(companyHeaders, content)
+
+	cdsHeaders := append([]string{"#", "company", "sn"}, billingHeaders...)
+	content = nil
+	for index, ret := range cdsResults {
+		index++
+		content = append(content, append([]string{strconv.Itoa(index), ret.company, ret.name}, billingRow(ret)...))
+	}
+	utils.PrintTable(cdsHeaders, content)
+
+	if output == "" {
+		return nil
+	}
+	if err = makeBillingExcel(companyResults, cdsResults, output); err != nil {
+		return err
+	}
+	utils.SuccessPrintln("保存账单成功: " + output)
+	return nil
+}
+
+// billingResults computes bandwidth billing of companies and cds, the bandwidth of a company at a time
+// is the sum of its cds. A cds is billed to the company recorded in its samples, companies of the current
+// cds list are used for samples without company. Coverage is the ratio of time covered by samples in period,
+// interval is used for samples without poll interval.
+func billingResults(samples []*history.Sample, companies map[string]string, interval, period time.Duration) ([]*billingResult, []*billingResult) {
+	type point struct {
+		time    int64
+		value   float64
+		count   int64
+		covered time.Duration
+	}
+	cdsPoints := make(map[string][]point)
+	cdsCompany := make(map[string]string)
+	companyPoints := make(map[string]map[int64]*point)
+	companyCDS := make(map[string]map[string]bool)
+
+	for _, s := range samples {
+		company := s.Company
+		if company == "" {
+			company = companies[s.SN]
+		}
+		if company == "" {
+			company = "unknown"
+		}
+		cdsCompany[s.SN] = company
+		count := sampleCount(s)
+		p := point{s.Time.Unix(), float64(s.ServiceKbps), count, time.Duration(count) * sampleInterval(s, interval)}
+		cdsPoints[s.SN] = append(cdsPoints[s.SN], p)
+
+		if companyPoints[company] == nil {
+			companyPoints[company] = make(map[int64]*point)
+			companyCDS[company] = make(map[string]bool)
+		}
+		companyCDS[company][s.SN] = true
+		if cp, ok := companyPoints[company][p.time]; ok {
+			cp.value += p.value
+			if p.count > cp.count {
+				cp.count = p.count
+			}
+			if p.covered > cp.covered {
+				cp.covered = p.covered
+			}
+		} else {
+			companyPoints[company][p.time] = &p
+		}
+	}
+
+	summary := func(points []point) *billingResult {
+		ret := new(billingResult)
+		values := make([]float64, 0, len(points))
+		counts := make([]int64, 0, len(points))
+		var sum float64
+		var covered time.Duration
+		for _, p := range points {
+			values = append(values, p.value)
+			counts = append(counts, p.count)
+			// downsampled point is weighted by the count of raw samples
+			sum += p.value * float64(p.count)
+			ret.samples += p.count
+			covered += p.covered
+			if p.value > ret.peak {
+				ret.peak = p.value
+			}
+		}
+		ret.p95 = utils.WeightedPercentile(values, counts, 95)
+		ret.avg = sum / float64(ret.samples)
+		ret.coverage = float64(covered) / float64(period)
+		if ret.coverage > 1 {
+			ret.coverage = 1
+		}
+		return ret
+	}
+
+	var cdsResults []*billingResult
+	for sn, points := range cdsPoints {
+		ret := summary(points)
+		ret.name, ret.company, ret.cdsCount = sn, cdsCompany[sn], 1
+		cdsResults = append(cdsResults, ret)
+	}
+
+	var companyResults []*billingResult
+	for company, pointMap := range companyPoints {
+		points := make([]point, 0, len(pointMap))
+		for _, p := range pointMap {
+			points = append(points, *p)
+		}
+		ret := summary(points)
+		ret.name, ret.company, ret.cdsCount = company, company, len(companyCDS[company])
+		companyResults = append(companyResults, ret)
+	}
+
+	for _, results := range [][]*billingResult{companyResults, cdsResults} {
+		results := results
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].p95 != results[j].p95 {
+				return results[i].p95 > results[j].p95
+			}
+			return results[i].name < results[j].name
+		})
+	}
+	return companyResults, cdsResults
+}
+
+// monthRange returns start and end of month formatted as 2006-01 in l
+func monthRange(month string, l *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, l)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("illegal month %q, it should be formatted as 2006-01", month)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// lastMonth returns last month of now in l formatted as 2006-01
+func lastMonth(now time.Time, l *time.Location) string {
+	now = now.In(l)
+	firstDay := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, l)
+	return firstDay.AddDate(0, -1, 0).Format("2006-01")
+}
+
+func billingRow(ret *billingResult) []string {
+	return []string{
+		mbps(ret.p95),
+		mbps(ret.peak),
+		mbps(ret.avg),
+		strconv.FormatInt(ret.samples, 10),
+		fmt.Sprintf("%0.1f%%", ret.coverage*100),
+	}
+}
+
+func mbps(kbps float64) string {
+	return fmt.Sprintf("%0.1f", kbps/1024)
+}
+
+func makeBillingExcel(companyResults, cdsResults []*billingResult, xlsxPath string) error {
+	file := xlsx.NewFile()
+	hStyle := headerStyle()
+
+	sheets := []struct {
+		name    string
+		headers []string
+		results []*billingResult
+		first   func(*billingResult) []string
+	}{
+		{"Company", append([]string{"Customer Name", "CDS"}, billingHeaders...), companyResults,
+			func(ret *billingResult) []string { return []string{ret.company, strconv.Itoa(ret.cdsCount)} }},
+		{"CDS", append([]string{"Customer Name", "SN"}, billingHeaders...), cdsResults,
+			func(ret *billingResult) []string { return []string{ret.company, ret.name} }},
+	}
+
+	for _, s := range sheets {
+		sheet, err := file.AddSheet(s.name)
+		if err != nil {
+			return fmt.Errorf("create new sheet %s %v", s.name, err)
+		}
+		row := sheet.AddRow()
+		for _, item := range s.headers {
+			cell := row.AddCell()
+			cell.SetStyle(hStyle)
+			cell.Value = item
+		}
+		for _, ret := range s.results {
+			rowData := append(s.first(ret), billingRow(ret)...)
+			row = sheet.AddRow()
+			row.WriteSlice(&rowData, len(rowData))
+		}
+	}
+
+	if err := file.Save(xlsxPath); err != nil {
+		return fmt.Errorf("save excel file %s %v", xlsxPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/super1-chen/fxoss/history"
+)
+
+func TestBillingResults(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	var samples []*history.Sample
+	for i := 0; i < 20; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		samples = append(samples,
+			&history.Sample{Time: ts, SN: "CAS1", Kind: "cds", ServiceKbps: int64(i+1) * 1024},
+			&history.Sample{Time: ts, SN: "CAS2", Kind: "cds", ServiceKbps: 1024},
+		)
+	}
+	// CAS3 is removed from the cds list, the hourly average is weighted by its 60 raw samples
+	samples = append(samples,
+		&history.Sample{Time: start, SN: "CAS3", Kind: "cds", ServiceKbps: 1024, Count: 60, Interval: 30 * time.Second, Company: "b"},
+		&history.Sample{Time: start.Add(time.Hour), SN: "CAS3", Kind: "cds", ServiceKbps: 100 * 1024, Count: 1, Interval: 30 * time.Second, Company: "b"},
+	)
+	companies := map[string]string{"CAS1": "a", "CAS2": "a"}
+
+	companyResults, cdsResults := billingResults(samples, companies, time.Minute, 40*time.Minute)
+
+	if len(companyResults) != 2 || len(cdsResults) != 3 {
+		t.Fatalf("got %d companies and %d cds != want 2 and 3", len(companyResults), len(cdsResults))
+	}
+	if removed := companyResults[1]; removed.company != "b" || removed.p95 != 1024 || removed.peak != 100*1024 || removed.samples != 61 {
+		t.Errorf("removed cds company result got: %+v", removed)
+	}
+	if removed := cdsResults[2]; removed.name != "CAS3" || removed.company != "b" || removed.coverage != 30.5/40 {
+		t.Errorf("removed cds result got: %+v", removed)
+	}
+
+	company := companyResults[0]
+	if company.company != "a" || company.cdsCount != 2 || company.samples != 20 {
+		t.Errorf("company result got: %+v", company)
+	}
+	if company.p95 != 20*1024 || company.peak != 21*1024 || company.coverage != 0.5 {
+		t.Errorf("company p95 %v peak %v coverage %v", company.p95, company.peak, company.coverage)
+	}
+
+	cds := cdsResults[0]
+	if cds.name != "CAS1" || cds.p95 != 19*1024 || cds.peak != 20*1024 || cds.avg != 10.5*1024 {
+		t.Errorf("cds result got: %+v", cds)
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	start, end, err := monthRange("2026-12", cst)
+	if err != nil {
+		t.Fatalf("monthRange failed %v", err)
+	}
+	if !start.Equal(time.Date(2026, 11, 30, 16, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 12, 31, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthRange got %s - %s", start, end)
+	}
+	if start, _, _ = monthRange("2026-12", time.UTC); !start.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthRange in UTC got %s", start)
+	}
+	if _, _, err := monthRange("2026-13", cst); err == nil {
+		t.Errorf("monthRange(%q) want err but err == nil", "2026-13")
+	}
+
+	// 2026-10-31 20:00 UTC is already November in CST
+	now := time.Date(2026, 10, 31, 20, 0, 0, 0, time.UTC)
+	if got := lastMonth(now, cst); got != "2026-10" {
+		t.Errorf("lastMonth in CST got %s", got)
+	}
+	if got := lastMonth(now, time.UTC); got != "2026-09" {
+		t.Errorf("lastMonth in UTC got %s", got)
+	}
+}
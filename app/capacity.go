@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var capacityHeaders = []string{
+	"#", "company", "sn", "status",
+	"service(max)", "service", "cache", "monitor",
+	"hit_ratio", "cache/service",
+}
+
+// ShowCDSCapacity shows over-utilised, under-utilised and anomalous cds,
+// a cds is over-utilised if the worst ratio of service, cache and monitor is not less than high
+// and under-utilised if less than low.
+func (oss *OSS) ShowCDSCapacity(high, low float64) error {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	over, under, anomalies := classifyCapacity(capacityResults(data.CDS), high, low)
+
+	utils.ColorPrintln(fmt.Sprintf("Over-utilised cds (worst ratio >= %.0f%% of max)", high*100), utils.Yellow)
+	printCapacity(over, nil)
+	utils.ColorPrintln(fmt.Sprintf("Under-utilised cds (worst ratio < %.0f%% of max)", low*100), utils.Yellow)
+	printCapacity(under, nil)
+	utils.ColorPrintln("Anomalous cds", utils.Yellow)
+	printCapacity(anomalies, capacityAnomaly)
+
+	return nil
+}
+
+// capacityResults computes the worst ratio and online state of the given cds list
+func capacityResults(cdsList []*cdsInfo) []*capacityResult {
+	results := make([]*capacityResult, 0, len(cdsList))
+	for _, cds := range cdsList {
+		ret := &capacityResult{cds: cds, online: utils.IsOnline(cds.Status)}
+		for _, v := range [][2]int64{
+			{cds.ServiceKbps, cds.ServiceKbpsMax},
+			{cds.CacheKbps, cds.CacheKbpsMax},
+			{cds.MonitorKbps, cds.MonitorKbpsMax},
+		} {
+			if v[1] <= 0 {
+				continue
+			}
+			if r := utils.Ratio(v[0], v[1]); !ret.measured || r > ret.ratio {
+				ret.ratio = r
+			}
+			ret.measured = true
+		}
+		results = append(results, ret)
+	}
+	return results
+}
+
+// classifyCapacity splits online cds into over-utilised and under-utilised cds ranked by the worst ratio
+// and anomalous cds, cds without any max are neither over nor under-utilised.
+func classifyCapacity(results []*capacityResult, high, low float64) (over, under, anomalies []*capacityResult) {
+	for _, ret := range results {
+		if !ret.online {
+			continue
+		}
+		if ret.measured && ret.ratio >= high {
+			over = append(over, ret)
+		}
+		if ret.measured && ret.ratio < low {
+			under = append(under, ret)
+		}
+		if capacityAnomaly(ret) != "" {
+			anomalies = append(anomalies, ret)
+		}
+	}
+
+	sort.SliceStable(over, func(i, j int) bool { return over[i].ratio > over[j].ratio })
+	sort.SliceStable(under, func(i, j int) bool { return under[i].ratio < under[j].ratio })
+	return over, under, anomalies
+}
+
+// capacityAnomaly returns the reason why an online cds looks abnormal, empty if it looks normal
+func capacityAnomaly(ret *capacityResult) string {
+	cds := ret.cds
+	switch {
+	case cds.OnlineUser > 0 && cds.HitUser == 0:
+		return "zero hit users"
+	case cds.OnlineUser == 0:
+		return "zero online users"
+	case cds.ServiceKbpsMax > 0 && cds.ServiceKbps > cds.ServiceKbpsMax:
+		return "service over max"
+	case cds.CacheKbpsMax > 0 && cds.CacheKbps > cds.CacheKbpsMax:
+		return "cache over max"
+	}
+	return ""
+}
+
+func printCapacity(results []*capacityResult, reason func(*capacityResult) string) {
+	if len(results) == 0 {
+		utils.SuccessPrintln("CDS list is empty")
+		return
+	}
+	headers := capacityHeaders
+	if reason != nil {
+		headers = append(headers[:len(headers):len(headers)], "reason")
+	}
+
+	var content [][]string
+	for index, ret := range results {
+		index++
+		cds := ret.cds
+		row := []string{
+			strconv.Itoa(index),
+			cds.Company,
+			cds.SN,
+			cds.Status,
+			utils.FormatItem(cds.ServiceKbps, cds.ServiceKbpsMax),
+			utils.FormatPercent(cds.ServiceKbps, cds.ServiceKbpsMax),
+			utils.FormatPercent(cds.CacheKbps, cds.CacheKbpsMax),
+			utils.FormatPercent(cds.MonitorKbps, cds.MonitorKbpsMax),
+			utils.FormatPercent(cds.HitUser, cds.OnlineUser),
+			utils.FormatPercent(cds.CacheKbps, cds.ServiceKbps),
+		}
+		if reason != nil {
+			row = append(row, reason(ret))
+		}
+		content = append(content, row)
+	}
+	utils.PrintTable(headers, content)
+}
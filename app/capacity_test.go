@@ -0,0 +1,56 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyCapacity(t *testing.T) {
+	cdsList := []*cdsInfo{
+		{SN: "BUSY", Status: "healthy", OnlineUser: 10, HitUser: 5, ServiceKbps: 95, ServiceKbpsMax: 100},
+		{SN: "CACHE", Status: "healthy", OnlineUser: 10, HitUser: 5, ServiceKbps: 5, ServiceKbpsMax: 100, CacheKbps: 92, CacheKbpsMax: 100},
+		{SN: "IDLE", Status: "healthy", OnlineUser: 10, HitUser: 5, ServiceKbps: 5, ServiceKbpsMax: 100, CacheKbps: 1, CacheKbpsMax: 100},
+		{SN: "IDLER", Status: "healthy", OnlineUser: 10, HitUser: 5, ServiceKbps: 1, ServiceKbpsMax: 100},
+		{SN: "NOMAX", Status: "healthy", OnlineUser: 10, HitUser: 5},
+		{SN: "DOWN", Status: "offline", ServiceKbps: 99, ServiceKbpsMax: 100},
+		{SN: "NOHIT", Status: "warn: icache offline", OnlineUser: 3, ServiceKbps: 50, ServiceKbpsMax: 100},
+	}
+	over, under, anomalies := classifyCapacity(capacityResults(cdsList), 0.9, 0.1)
+
+	sns := func(results []*capacityResult) string {
+		var s []string
+		for _, ret := range results {
+			s = append(s, ret.cds.SN)
+		}
+		return strings.Join(s, ",")
+	}
+	if got := sns(over); got != "BUSY,CACHE" {
+		t.Errorf("over got %s", got)
+	}
+	if got := sns(under); got != "IDLER,IDLE" {
+		t.Errorf("under got %s", got)
+	}
+	if got := sns(anomalies); got != "NOHIT" {
+		t.Errorf("anomalies got %s", got)
+	}
+}
+
+func TestCapacityAnomaly(t *testing.T) {
+	testCases := []struct {
+		cds  cdsInfo
+		want string
+	}{
+		{cdsInfo{OnlineUser: 3, HitUser: 1, ServiceKbps: 5, ServiceKbpsMax: 10}, ""},
+		{cdsInfo{OnlineUser: 3}, "zero hit users"},
+		{cdsInfo{}, "zero online users"},
+		{cdsInfo{OnlineUser: 3, HitUser: 1, ServiceKbps: 11, ServiceKbpsMax: 10}, "service over max"},
+		{cdsInfo{OnlineUser: 3, HitUser: 1, ServiceKbps: 11}, ""},
+		{cdsInfo{OnlineUser: 3, HitUser: 1, CacheKbps: 11, CacheKbpsMax: 10}, "cache over max"},
+	}
+	for _, c := range testCases {
+		cds := c.cds
+		if got := capacityAnomaly(&capacityResult{cds: &cds}); got != c.want {
+			t.Errorf("capacityAnomaly(%+v) got %q != want %q", c.cds, got, c.want)
+		}
+	}
+}
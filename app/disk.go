@@ -0,0 +1,163 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var diskHeaders = []string{"name", "status", "util(%)", "await(ms)", "rs", "ws", "size", "used", "usage"}
+
+// diskThreshold holds limits from which a disk is unhealthy
+type diskThreshold struct {
+	Util  float64 // util percent
+	Await float64 // await in milliseconds
+	Usage float64 // used/size ratio
+}
+
+// ShowCDSDisks shows disks of cds by specified sn
+func (oss *OSS) ShowCDSDisks(sn string) error {
+
+	diskList, err := oss.getDisks(sn)
+	if err != nil {
+		return err
+	}
+
+	if len(diskList.Disk) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("Disks list of CDS %q is empty", sn), utils.Yellow)
+		return nil
+	}
+
+	sort.Slice(diskList.Disk, func(i, j int) bool { return diskList.Disk[i].Name < diskList.Disk[j].Name })
+
+	headers := append([]string{"#"}, diskHeaders...)
+	var content [][]string
+	for index, d := range diskList.Disk {
+		index++
+		content = append(content, append([]string{strconv.Itoa(index)}, diskRow(d)...))
+	}
+	utils.PrintTable(headers, content)
+	return nil
+}
+
+// ShowDiskHealth scans disks of all cds and shows failed disks, disks whose util or await
+// is not less than the given limits and disks whose used/size ratio is not less than maxUsage.
+func (oss *OSS) ShowDiskHealth(maxUtil, maxAwait, maxUsage float64) error {
+	threshold := diskThreshold{Util: maxUtil, Await: maxAwait, Usage: maxUsage}
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	results, failed := oss.scanDiskHealth(data.CDS, threshold)
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		utils.ErrorPrintln(fmt.Sprintf("获取%d台cds磁盘信息失败: %s", len(failed), strings.Join(failed, ", ")), false)
+	}
+
+	if len(results) == 0 {
+		utils.SuccessPrintln("All disks are healthy")
+		return nil
+	}
+
+	headers := append([]string{"#", "company", "cds_sn", "problem"}, diskHeaders...)
+	var content [][]string
+	for index, ret := range results {
+		index++
+		row := []string{strconv.Itoa(index), ret.cds.Company, ret.cds.SN, strings.Join(ret.problems, ",")}
+		content = append(content, append(row, diskRow(ret.disk)...))
+	}
+	utils.PrintTable(headers, content)
+	return nil
+}
+
+// scanDiskHealth fetches disks of cds concurrently, it returns unhealthy disks
+// and sn of cds whose disks could not be fetched.
+func (oss *OSS) scanDiskHealth(cdsList []*cdsInfo, threshold diskThreshold) ([]*diskHealthResult, []string) {
+	wg := &sync.WaitGroup{}
+	mu := &sync.Mutex{}
+	in := make(chan *cdsInfo)
+	var results []*diskHealthResult
+	var failed []string
+
+	for i := 0; i < oss.settings.Report.CDSWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cds := range in {
+				diskList, err := oss.getDisks(cds.SN)
+				mu.Lock()
+				if err != nil {
+					oss.logger.Printf("get disks of %s failed %v", cds.SN, err)
+					failed = append(failed, cds.SN)
+				} else {
+					for _, d := range diskList.Disk {
+						if problems := diskProblems(d, threshold); len(problems) > 0 {
+							results = append(results, &diskHealthResult{cds: cds, disk: d, problems: problems})
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, cds := range cdsList {
+		in <- cds
+	}
+	close(in)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].cds.SN != results[j].cds.SN {
+			return results[i].cds.SN < results[j].cds.SN
+		}
+		return results[i].disk.Name < results[j].disk.Name
+	})
+	return results, failed
+}
+
+// diskProblems checks disk against the threshold and returns its problems
+func diskProblems(d *disk, threshold diskThreshold) []string {
+	var problems []string
+	if d.Status != 0 {
+		problems = append(problems, "failed")
+	}
+	if util, err := utils.ParseNumber(d.Util); err == nil && util >= threshold.Util {
+		problems = append(problems, "busy")
+	}
+	if await, err := utils.ParseNumber(d.Await); err == nil && await >= threshold.Await {
+		problems = append(problems, "slow")
+	}
+	if usage, ok := diskUsage(d); ok && usage >= threshold.Usage {
+		problems = append(problems, "full")
+	}
+	return problems
+}
+
+// diskUsage returns used/size ratio of disk
+func diskUsage(d *disk) (float64, bool) {
+	size, err := utils.ParseSize(d.Size)
+	if err != nil || size == 0 {
+		return 0, false
+	}
+	used, err := utils.ParseSize(d.used())
+	if err != nil {
+		return 0, false
+	}
+	return used / size, true
+}
+
+func diskRow(d *disk) []string {
+	usage := "-"
+	if ratio, ok := diskUsage(d); ok {
+		usage = fmt.Sprintf("%0.1f%%", ratio*100)
+	}
+	return []string{d.Name, strconv.FormatInt(d.Status, 10), d.Util, d.Await, d.RS, d.WS, d.Size, d.used(), usage}
+}
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/scorredoira/email"
+
+	"github.com/super1-chen/fxoss/logger"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+const (
+	securityTLS      = "tls"
+	securitySTARTTLS = "starttls"
+	securityNone     = "none"
+
+	defaultFromName = "Operation Robot"
+)
+
+// TestEmail checks smtp settings of fx_email.json by sending a probe message to toList,
+// the probe is sent to the sender itself if toList is empty.
+func TestEmail(verbose bool, toList ...string) error {
+	oss := &OSS{logger: logger.Mylogger(verbose)}
+	conf, err := oss.loadEmailConfig()
+	if err != nil {
+		return err
+	}
+	if len(toList) == 0 {
+		toList = []string{conf.Address}
+	} else if toList, err = conf.recipients(toList); err != nil {
+		return err
+	}
+
+	utils.ColorPrintln(fmt.Sprintf("连接 %s:%d, security: %s, auth: %s", conf.host, conf.port, conf.securityText(), conf.Auth), utils.Yellow)
+	m := email.NewMessage("FxData CDS test message",
+		fmt.Sprintf("It works.\r\n\r\nsent by fxoss at %s via %s:%d", time.Now().Format(time.RFC3339), conf.host, conf.port))
+	m.To = toList
+	if err = oss.deliverEmail(conf, m); err != nil {
+		return err
+	}
+	utils.SuccessPrintln("发送测试邮件成功: " + strings.Join(toList, ", "))
+	return nil
+}
+
+// setDefaults splits host and port of smtp_server and validates security and auth
+func (c *emailConf) setDefaults() error {
+	if c.SMTPServer == "" {
+		return errors.New("smtp_server is required")
+	}
+	if c.Address == "" {
+		return errors.New("address is required")
+	}
+	c.Security, c.Auth = strings.ToLower(c.Security), strings.ToLower(c.Auth)
+	switch c.Security {
+	case "", securityTLS, securitySTARTTLS, securityNone:
+	case "ssl":
+		c.Security = securityTLS
+	default:
+		return fmt.Errorf("illegal security %q, it should be tls, starttls or none", c.Security)
+	}
+	switch c.Auth {
+	case "":
+		c.Auth = "plain"
+	case "plain", "login", "cram-md5", "none":
+	default:
+		return fmt.Errorf("illegal auth %q, it should be plain, login, cram-md5 or none", c.Auth)
+	}
+	if c.Username == "" {
+		c.Username = c.Address
+	}
+	if c.FromName == "" {
+		c.FromName = defaultFromName
+	}
+	if c.Subject == "" {
+		c.Subject = defaultReportSubject
+	}
+	if _, err := textTemplate.New("subject").Parse(c.Subject); err != nil {
+		return fmt.Errorf("illegal subject template %q: %v", c.Subject, err)
+	}
+
+	c.host, c.port = c.SMTPServer, c.Port
+	if host, port, err := net.SplitHostPort(c.SMTPServer); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("illegal port of smtp_server %q", c.SMTPServer)
+		}
+		c.host = host
+		if c.port == 0 {
+			c.port = p
+		}
+	}
+	if c.port == 0 {
+		switch c.Security {
+		case securityTLS:
+			c.port = 465
+		case securitySTARTTLS:
+			c.port = 587
+		default:
+			c.port = 25
+		}
+	}
+	if c.Security == "" && c.port == 465 {
+		c.Security = securityTLS
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "30s"
+	}
+	d, err := utils.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("illegal timeout %q", c.Timeout)
+	}
+	c.timeout = d
+	return nil
+}
+
+func (c *emailConf) securityText() string {
+	if c.Security == "" {
+		return "starttls if offered"
+	}
+	return c.Security
+}
+
+func (c *emailConf) from() mail.Address {
+	return mail.Address{Name: c.FromName, Address: c.Address}
+}
+
+func (c *emailConf) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: c.host, InsecureSkipVerify: c.SkipVerify}
+}
+
+func (c *emailConf) auth() smtp.Auth {
+	switch c.Auth {
+	case "login":
+		return &loginAuth{username: c.Username, password: c.Password}
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(c.Username, c.Password)
+	case "none":
+		return nil
+	}
+	return smtp.PlainAuth("", c.Username, c.Password, c.host)
+}
+
+// deliverEmail sends m from the configured address with the smtp settings
+func (oss *OSS) deliverEmail(conf *emailConf, m *email.Message) error {
+	m.From = conf.from()
+	if err := sendMail(conf, m.From.Address, m.Tolist(), m.Bytes()); err != nil {
+		oss.logger.Printf("send mail via %s:%d failed: %v", conf.host, conf.port, err)
+		return fmt.Errorf("send mail failed %v", err)
+	}
+	oss.logger.Printf("send mail via %s:%d to %v", conf.host, conf.port, m.Tolist())
+	return nil
+}
+
+// sendMail is smtp.SendMail with implicit tls, required or opportunistic starttls,
+// the configured auth mechanism and a timeout of the whole session
+func sendMail(conf *emailConf, from string, to []string, msg []byte) error {
+	if len(to) == 0 {
+		return errors.New("no recipient")
+	}
+	addr := net.JoinHostPort(conf.host, strconv.Itoa(conf.port))
+	dialer := &net.Dialer{Timeout: conf.timeout}
+
+	var conn net.Conn
+	var err error
+	if conf.Security == securityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, conf.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect %s failed %v", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(conf.timeout))
+
+	c, err := smtp.NewClient(conn, conf.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake with %s failed %v", addr, err)
+	}
+	defer c.Close()
+
+	if conf.Security == securitySTARTTLS || conf.Security == "" {
+		ok, _ := c.Extension("STARTTLS")
+		if !ok && conf.Security == securitySTARTTLS {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if ok {
+			if err = c.StartTLS(conf.tlsConfig()); err != nil {
+				return fmt.Errorf("starttls failed %v", err)
+			}
+		}
+	}
+
+	if auth := conf.auth(); auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("%s does not support AUTH", addr)
+		}
+		if err = c.Auth(auth); err != nil {
+			return fmt.Errorf("auth %s as %s failed %v", conf.Auth, conf.Username, err)
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return fmt.Errorf("mail from %s failed %v", from, err)
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt to %s failed %v", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data failed %v", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("write message failed %v", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("message is rejected %v", err)
+	}
+	return c.Quit()
+}
+
+// loginAuth implements the LOGIN mechanism which net/smtp lacks, like smtp.PlainAuth
+// it refuses to send the password over an unencrypted connection except to localhost.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(strings.TrimSuffix(string(fromServer), ":"))) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,243 @@
+package app
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpStub is a local smtp server accepting one session, it records how the session went
+type smtpStub struct {
+	ln       net.Listener
+	cert     tls.Certificate
+	implicit bool // implicit tls
+	starttls bool // offer STARTTLS
+	user     string
+	password string
+
+	tls  bool
+	auth string
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPStub(t *testing.T, implicit, starttls bool) *smtpStub {
+	// borrow the self-signed certificate of httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	s := &smtpStub{cert: cert, implicit: implicit, starttls: starttls, user: "robot@fxdata.cn", password: "secret", done: make(chan struct{})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit {
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+		s.tls = true
+	}
+	s.ln = ln
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	s.ln.Close()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, v ...interface{}) { fmt.Fprintf(conn, format+"\r\n", v...) }
+	read := func() string {
+		line, _ := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+
+	reply("220 localhost ESMTP stub")
+	for {
+		line := read()
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO":
+			reply("250-localhost")
+			if s.starttls && !s.tls {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN LOGIN CRAM-MD5")
+		case cmd == "STARTTLS":
+			reply("220 ready")
+			tc := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, r, s.tls = tc, bufio.NewReader(tc), true
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH PLAIN"):
+			s.auth = "plain"
+			if decode(strings.Fields(line)[2]) != "\x00"+s.user+"\x00"+s.password {
+				reply("535 bad credentials")
+				continue
+			}
+			reply("235 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH LOGIN"):
+			s.auth = "login"
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+			user := decode(read())
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+			if user != s.user || decode(read()) != s.password {
+				reply("535 bad credentials")
+				continue
+			}
+			reply("235 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH CRAM-MD5"):
+			s.auth = "cram-md5"
+			challenge := "<1.2@localhost>"
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+			h := hmac.New(md5.New, []byte(s.password))
+			h.Write([]byte(challenge))
+			if decode(read()) != s.user+" "+hex.EncodeToString(h.Sum(nil)) {
+				reply("535 bad credentials")
+				continue
+			}
+			reply("235 ok")
+		case cmd == "MAIL":
+			s.from = line
+			reply("250 ok")
+		case cmd == "RCPT":
+			s.rcpt = append(s.rcpt, strings.Trim(strings.SplitN(line, ":", 2)[1], "<> "))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var lines []string
+			for l := read(); l != "."; l = read() {
+				lines = append(lines, l)
+			}
+			s.data = strings.Join(lines, "\n")
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		case line == "":
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	testCases := []struct {
+		security           string
+		implicit, starttls bool
+		auth               string
+		wantTLS            bool
+	}{
+		{"tls", true, false, "plain", true},
+		{"starttls", false, true, "login", true},
+		{"", false, true, "cram-md5", true},
+		{"", false, false, "plain", false},
+		{"none", false, true, "login", false},
+	}
+	for _, c := range testCases {
+		stub := newSMTPStub(t, c.implicit, c.starttls)
+		conf := &emailConf{
+			Address: "robot@fxdata.cn", Password: "secret", SMTPServer: "127.0.0.1:" + strconv.Itoa(stub.port()),
+			Security: c.security, Auth: c.auth, FromName: "Ops", SkipVerify: true,
+		}
+		if err := conf.setDefaults(); err != nil {
+			t.Fatal(err)
+		}
+		m := []byte("Subject: test\r\n\r\nIt works.\r\n")
+		err := sendMail(conf, conf.Address, []string{"a@fxdata.cn", "b@ifeixiang.com"}, m)
+		<-stub.done
+		if err != nil {
+			t.Errorf("%s/%s send mail error %v", c.security, c.auth, err)
+			continue
+		}
+		if stub.tls != c.wantTLS || stub.auth != c.auth {
+			t.Errorf("%s/%s got tls %v auth %q", c.security, c.auth, stub.tls, stub.auth)
+		}
+		if len(stub.rcpt) != 2 || stub.rcpt[1] != "b@ifeixiang.com" || !strings.Contains(stub.data, "It works.") {
+			t.Errorf("%s/%s got rcpt %v data %q", c.security, c.auth, stub.rcpt, stub.data)
+		}
+	}
+}
+
+func TestSendMail_Failures(t *testing.T) {
+	// starttls is required but not offered
+	stub := newSMTPStub(t, false, false)
+	conf := &emailConf{Address: "robot@fxdata.cn", Password: "secret", SMTPServer: "127.0.0.1", Port: stub.port(), Security: "starttls"}
+	conf.setDefaults()
+	if err := sendMail(conf, conf.Address, []string{"a@fxdata.cn"}, []byte("test")); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("got error %v, want STARTTLS error", err)
+	}
+	<-stub.done
+
+	// wrong password
+	stub = newSMTPStub(t, false, false)
+	conf = &emailConf{Address: "robot@fxdata.cn", Password: "wrong", SMTPServer: "127.0.0.1", Port: stub.port(), Auth: "login"}
+	conf.setDefaults()
+	if err := sendMail(conf, conf.Address, []string{"a@fxdata.cn"}, []byte("test")); err == nil || !strings.Contains(err.Error(), "auth login") {
+		t.Errorf("got error %v, want auth error", err)
+	}
+	<-stub.done
+}
+
+func TestEmailConf_SetDefaults(t *testing.T) {
+	testCases := []struct {
+		conf               emailConf
+		host               string
+		port               int
+		security, fromName string
+	}{
+		{emailConf{SMTPServer: "smtp.exmail.qq.com"}, "smtp.exmail.qq.com", 25, "", "Operation Robot"},
+		{emailConf{SMTPServer: "smtp.exmail.qq.com:465"}, "smtp.exmail.qq.com", 465, "tls", "Operation Robot"},
+		{emailConf{SMTPServer: "smtp.exmail.qq.com", Security: "STARTTLS", FromName: "Ops"}, "smtp.exmail.qq.com", 587, "starttls", "Ops"},
+		{emailConf{SMTPServer: "smtp.exmail.qq.com:25", Port: 2525, Security: "ssl"}, "smtp.exmail.qq.com", 2525, "tls", "Operation Robot"},
+	}
+	for _, c := range testCases {
+		conf := c.conf
+		conf.Address = "robot@fxdata.cn"
+		if err := conf.setDefaults(); err != nil {
+			t.Errorf("%+v setDefaults error %v", c.conf, err)
+			continue
+		}
+		if conf.host != c.host || conf.port != c.port || conf.Security != c.security || conf.FromName != c.fromName || conf.Username != conf.Address {
+			t.Errorf("%+v got %s:%d %s %s", c.conf, conf.host, conf.port, conf.Security, conf.FromName)
+		}
+	}
+
+	for _, conf := range []emailConf{
+		{Address: "robot@fxdata.cn"},
+		{Address: "robot@fxdata.cn", SMTPServer: "smtp", Security: "ssl3"},
+		{Address: "robot@fxdata.cn", SMTPServer: "smtp", Auth: "xoauth2"},
+		{Address: "robot@fxdata.cn", SMTPServer: "smtp:abc"},
+	} {
+		if err := conf.setDefaults(); err == nil {
+			t.Errorf("%+v setDefaults should return error", conf)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// gauge is a metric of prometheus exporter, a series is skipped if ok is false
+type gauge struct {
+	name, help string
+	value      func(cds *cdsInfo, now time.Time, l *time.Location) (v float64, ok bool)
+}
+
+// nodeGauge is a metric of nodes
+type nodeGauge struct {
+	name, help string
+	value      func(n *node) float64
+}
+
+var (
+	cdsGauges = []gauge{
+		{"fxoss_cds_online", "1 if the cds is online", cdsOnline},
+		{"fxoss_cds_online_users", "Online users of the cds", cdsValue(func(c *cdsInfo) int64 { return c.OnlineUser })},
+		{"fxoss_cds_online_users_max", "Max online users of the cds", cdsValue(func(c *cdsInfo) int64 { return c.OnlineUserMax })},
+		{"fxoss_cds_hit_users", "Hit users of the cds", cdsValue(func(c *cdsInfo) int64 { return c.HitUser })},
+		{"fxoss_cds_hit_users_max", "Max hit users of the cds", cdsValue(func(c *cdsInfo) int64 { return c.HitUserMax })},
+		{"fxoss_cds_service_kbps", "Service bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.ServiceKbps })},
+		{"fxoss_cds_service_kbps_max", "Max service bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.ServiceKbpsMax })},
+		{"fxoss_cds_cache_kbps", "Cache bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.CacheKbps })},
+		{"fxoss_cds_cache_kbps_max", "Max cache bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.CacheKbpsMax })},
+		{"fxoss_cds_monitor_kbps", "Monitor bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.MonitorKbps })},
+		{"fxoss_cds_monitor_kbps_max", "Max monitor bandwidth of the cds in kbps", cdsValue(func(c *cdsInfo) int64 { return c.MonitorKbpsMax })},
+		{"fxoss_cds_license_days_remaining", "Days until the cds license expires, negative after it expired", licenseDaysRemaining},
+	}
+	nodeGauges = []nodeGauge{
+		{"fxoss_node_online", "1 if the node is online", func(n *node) float64 { return boolValue(utils.IsOnline(n.Status)) }},
+		{"fxoss_node_hit_users", "Hit users of the node", func(n *node) float64 { return float64(n.HitUser) }},
+		{"fxoss_node_hit_users_max", "Max hit users of the node", func(n *node) float64 { return float64(n.HitUserMax) }},
+		{"fxoss_node_service_kbps", "Service bandwidth of the node in kbps", func(n *node) float64 { return float64(n.ServiceKbps) }},
+		{"fxoss_node_service_kbps_max", "Max service bandwidth of the node in kbps", func(n *node) float64 { return float64(n.ServiceKbpsMax) }},
+		{"fxoss_node_cache_kbps", "Cache bandwidth of the node in kbps", func(n *node) float64 { return float64(n.CacheKbps) }},
+		{"fxoss_node_cache_kbps_max", "Max cache bandwidth of the node in kbps", func(n *node) float64 { return float64(n.CacheKbpsMax) }},
+	}
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// metricsCache keeps the last rendered metrics, scrapes never call api
+type metricsCache struct {
+	mu        sync.RWMutex
+	body      []byte
+	labels    map[string][]string // label names keyed by cds sn
+	refreshed time.Time
+	failures  int64
+	up        bool
+}
+
+// RunExporter serves cds metrics in prometheus text format on listen until it is stopped,
+// metrics are refreshed from api every refresh in background.
+func (oss *OSS) RunExporter(listen string, refresh time.Duration) error {
+	if refresh <= 0 {
+		return fmt.Errorf("illegal refresh %s", refresh)
+	}
+	cache := new(metricsCache)
+	oss.refreshMetrics(cache)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", cache.serveHTTP)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `<html><body><a href="/metrics">metrics</a></body></html>`)
+	})
+	server := &http.Server{Addr: listen, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+	utils.SuccessPrintln(fmt.Sprintf("Serve metrics on %s/metrics, refresh every %s", listen, refresh))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			oss.refreshMetrics(cache)
+		case err := <-errs:
+			return fmt.Errorf("serve metrics failed %v", err)
+		case sig := <-sigs:
+			utils.ColorPrintln(fmt.Sprintf("receive signal %s, stop exporter", sig), utils.Yellow)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return server.Shutdown(ctx)
+		}
+	}
+}
+
+// refreshMetrics fetches cds list and labels and renders metrics into cache,
+// the last metrics are kept if it fails and labels of the last refresh are used if labels fail.
+func (oss *OSS) refreshMetrics(cache *metricsCache) {
+	now := time.Now().UTC()
+	oss.ensureToken(now)
+
+	data, err := oss.listCDS()
+	if err != nil {
+		oss.logger.Printf("refresh metrics failed %v", err)
+		cache.mu.Lock()
+		cache.failures++
+		cache.up = false
+		cache.mu.Unlock()
+		return
+	}
+
+	cache.mu.RLock()
+	labels := cache.labels
+	cache.mu.RUnlock()
+	if members, err := oss.labelSNs(); err != nil {
+		oss.logger.Printf("refresh labels of metrics failed %v", err)
+	} else {
+		labels = cdsLabels(members)
+	}
+
+	buf := new(bytes.Buffer)
+	writeMetrics(buf, data.CDS, labels, now, oss.settings.location)
+
+	cache.mu.Lock()
+	cache.body, cache.labels, cache.refreshed, cache.up = buf.Bytes(), labels, now, true
+	cache.mu.Unlock()
+	oss.logger.Printf("refresh metrics of %d cds", len(data.CDS))
+}
+
+func (cache *metricsCache) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(cache.body)
+	writeGauge(w, "fxoss_exporter_up", "1 if the last refresh from api succeeded")
+	fmt.Fprintf(w, "fxoss_exporter_up %d\n", int(boolValue(cache.up)))
+	writeGauge(w, "fxoss_exporter_last_refresh_timestamp_seconds", "Unix time of the last successful refresh")
+	fmt.Fprintf(w, "fxoss_exporter_last_refresh_timestamp_seconds %d\n", cache.refreshed.Unix())
+	fmt.Fprintf(w, "# HELP fxoss_exporter_refresh_failures_total Failed refreshes from api\n# TYPE fxoss_exporter_refresh_failures_total counter\n")
+	fmt.Fprintf(w, "fxoss_exporter_refresh_failures_total %d\n", cache.failures)
+}
+
+// writeMetrics writes gauges of cds and nodes in prometheus text format
+func writeMetrics(w io.Writer, cdsList []*cdsInfo, labels map[string][]string, now time.Time, l *time.Location) {
+	sorted := make([]*cdsInfo, len(cdsList))
+	copy(sorted, cdsList)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].SN < sorted[j].SN })
+
+	for _, g := range cdsGauges {
+		writeGauge(w, g.name, g.help)
+		for _, cds := range sorted {
+			v, ok := g.value(cds, now, l)
+			if !ok {
+				continue
+			}
+			writeSeries(w, g.name, v,
+				"sn", cds.SN, "company", cds.Company, "version", cds.Version, "label", strings.Join(labels[cds.SN], ","))
+		}
+	}
+
+	for _, g := range nodeGauges {
+		writeGauge(w, g.name, g.help)
+		for _, cds := range sorted {
+			for _, n := range cds.Nodes {
+				writeSeries(w, g.name, g.value(n),
+					"sn", n.SN, "type", n.Type, "cds_sn", cds.SN, "company", cds.Company)
+			}
+		}
+	}
+}
+
+func writeGauge(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// writeSeries writes a sample, labels are pairs of name and value
+func writeSeries(w io.Writer, name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// cdsLabels converts sn of label members to sorted label names of every cds
+func cdsLabels(members map[string]map[string]bool) map[string][]string {
+	labels := make(map[string][]string)
+	for name, sns := range members {
+		for sn := range sns {
+			labels[sn] = append(labels[sn], name)
+		}
+	}
+	for sn := range labels {
+		sort.Strings(labels[sn])
+	}
+	return labels
+}
+
+// cdsValue makes the value func of a gauge from a metric of cds
+func cdsValue(metric func(c *cdsInfo) int64) func(*cdsInfo, time.Time, *time.Location) (float64, bool) {
+	return func(c *cdsInfo, _ time.Time, _ *time.Location) (float64, bool) { return float64(metric(c)), true }
+}
+
+func cdsOnline(c *cdsInfo, _ time.Time, _ *time.Location) (float64, bool) {
+	return boolValue(utils.IsOnline(c.Status)), true
+}
+
+func licenseDaysRemaining(cds *cdsInfo, now time.Time, l *time.Location) (float64, bool) {
+	t, err := utils.ParseTime(cds.LicenseEndAt, l)
+	if err != nil {
+		return 0, false
+	}
+	return float64(daysLeft(t, now)), true
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
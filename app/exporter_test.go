@@ -0,0 +1,40 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	now := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	cdsList := []*cdsInfo{
+		{SN: "CAS2", Company: `a"b`, Status: "offline", Version: "1.0", LicenseEndAt: "bad"},
+		{SN: "CAS1", Company: "c", Status: "warn: icache offline", Version: "2.0", ServiceKbps: 1024,
+			LicenseEndAt: "2026-09-11 08:00:00",
+			Nodes:        []*node{{SN: "VAS1", Type: "cnc_live", Status: "offline", HitUser: 3}}},
+	}
+	labels := map[string][]string{"CAS1": {"north", "south"}}
+
+	buf := new(bytes.Buffer)
+	writeMetrics(buf, cdsList, labels, now, time.FixedZone("CST", 8*3600))
+	got := buf.String()
+
+	for _, want := range []string{
+		"# HELP fxoss_cds_online 1 if the cds is online\n# TYPE fxoss_cds_online gauge\n" +
+			`fxoss_cds_online{sn="CAS1",company="c",version="2.0",label="north,south"} 1` + "\n" +
+			`fxoss_cds_online{sn="CAS2",company="a\"b",version="1.0",label=""} 0` + "\n",
+		`fxoss_cds_service_kbps{sn="CAS1",company="c",version="2.0",label="north,south"} 1024`,
+		`fxoss_cds_license_days_remaining{sn="CAS1",company="c",version="2.0",label="north,south"} 10`,
+		`fxoss_node_online{sn="VAS1",type="cnc_live",cds_sn="CAS1",company="c"} 0`,
+		`fxoss_node_hit_users{sn="VAS1",type="cnc_live",cds_sn="CAS1",company="c"} 3`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(got, `fxoss_cds_license_days_remaining{sn="CAS2"`) {
+		t.Errorf("license days of illegal license end should be skipped")
+	}
+}
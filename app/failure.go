@@ -0,0 +1,132 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// stages of the report pipeline
+const (
+	stageLabels  = "labels"
+	stageCDSList = "cds of label"
+	stageCDS     = "cds"
+	stageData    = "report data" // data of the report type besides cds of labels, such as nem nodes
+)
+
+var failureHeaders = []string{"Stage", "Label", "Customer Name", "SN", "Status", "Error"}
+
+// fetchFailure is a failed fetch of the report pipeline
+type fetchFailure struct {
+	stage, label, err string
+	cds               *cdsInfo // nil unless the fetch is of a cds
+}
+
+// fetchFailures counts fetches and failed fetches of the report pipeline, it is safe for workers
+type fetchFailures struct {
+	mu      sync.Mutex
+	fetches int
+	stages  map[string]int // fetches of every stage
+	list    []*fetchFailure
+}
+
+// add counts a fetch of stage, it is a failure if err is not nil
+func (f *fetchFailures) add(stage, label string, c *cdsInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches++
+	if f.stages == nil {
+		f.stages = make(map[string]int)
+	}
+	f.stages[stage]++
+	if err != nil {
+		f.list = append(f.list, &fetchFailure{stage: stage, label: label, err: err.Error(), cds: c})
+	}
+}
+
+// count returns failed fetches and all fetches
+func (f *fetchFailures) count() (failed, total int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.list), f.fetches
+}
+
+// exceeds returns an error if all fetches of a stage failed, such as every label,
+// or failed fetches reach threshold, the ratio of all fetches
+func (f *fetchFailures) exceeds(threshold float64) error {
+	failed, total := f.count()
+	if failed == 0 {
+		return nil
+	}
+	if stage := f.failedStage(); stage != "" {
+		return fmt.Errorf("all fetches of %s failed", stage)
+	}
+	if ratio := float64(failed) / float64(total); ratio >= threshold {
+		return fmt.Errorf("%d of %d fetches failed, ratio %.2f reaches fail threshold %.2f", failed, total, ratio, threshold)
+	}
+	return nil
+}
+
+// failedStage returns the first stage whose fetches all failed, it is empty if there is no such stage
+func (f *fetchFailures) failedStage() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failed := make(map[string]int)
+	for _, failure := range f.list {
+		failed[failure.stage]++
+	}
+	for _, stage := range []string{stageLabels, stageCDSList, stageCDS, stageData} {
+		if n := f.stages[stage]; n > 0 && failed[stage] == n {
+			return stage
+		}
+	}
+	return ""
+}
+
+// wrap returns err with failed fetches, so they are not lost if a later step fails
+func (f *fetchFailures) wrap(err error) error {
+	if ferr := f.err(); ferr != nil {
+		return fmt.Errorf("%v, %v", err, ferr)
+	}
+	return err
+}
+
+// err returns an error of failed fetches, it is nil if all fetches succeeded
+func (f *fetchFailures) err() error {
+	if failed, total := f.count(); failed > 0 {
+		return fmt.Errorf("%d of %d fetches failed, see sheet %s of the report", failed, total, errorSheet)
+	}
+	return nil
+}
+
+// sheet makes the errors sheet of failed fetches sorted by stage, label and sn, it is nil if there is no failure
+func (f *fetchFailures) sheet() *reportSheet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.list) == 0 {
+		return nil
+	}
+	order := map[string]int{stageLabels: 0, stageCDSList: 1, stageCDS: 2, stageData: 3}
+	list := make([]*fetchFailure, len(f.list))
+	copy(list, f.list)
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.stage != b.stage {
+			return order[a.stage] < order[b.stage]
+		}
+		if a.label != b.label {
+			return a.label < b.label
+		}
+		return a.cds != nil && b.cds != nil && a.cds.SN < b.cds.SN
+	})
+
+	sheet := &reportSheet{Name: errorSheet, Headers: failureHeaders}
+	for _, failure := range list {
+		var company, sn, status string
+		if c := failure.cds; c != nil {
+			company, sn, status = c.Company, c.SN, c.Status
+		}
+		sheet.Rows = append(sheet.Rows, []interface{}{failure.stage, failure.label, company, sn, status, failure.err})
+	}
+	return sheet
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFetchFailures(t *testing.T) {
+	f := new(fetchFailures)
+	if f.err() != nil || f.exceeds(0) != nil || f.sheet() != nil {
+		t.Errorf("no failure should not return errors or sheet")
+	}
+
+	f.add(stageLabels, "", nil, nil)
+	f.add(stageCDS, "江苏", &cdsInfo{SN: "CAS2", Company: "苏州大学", Status: "healthy"}, errors.New("timeout"))
+	f.add(stageCDS, "江苏", &cdsInfo{SN: "CAS1"}, nil)
+	f.add(stageCDSList, "南京", nil, errors.New("status 500"))
+	f.add(stageCDSList, "江苏", nil, nil)
+
+	if failed, total := f.count(); failed != 2 || total != 5 {
+		t.Errorf("got %d failed of %d", failed, total)
+	}
+	if err := f.err(); err == nil || !strings.Contains(err.Error(), "2 of 5") {
+		t.Errorf("got error %v", err)
+	}
+	if err := f.wrap(errors.New("send failed")); err == nil || !strings.HasPrefix(err.Error(), "send failed, 2 of 5") {
+		t.Errorf("wrap got error %v", err)
+	}
+	for threshold, exceeds := range map[float64]bool{0: true, 0.4: true, 0.5: false, 1: false} {
+		if err := f.exceeds(threshold); (err != nil) != exceeds {
+			t.Errorf("exceeds(%v) got %v", threshold, err)
+		}
+	}
+
+	sheet := f.sheet()
+	var rows []string
+	for _, row := range sheet.Rows {
+		rows = append(rows, strings.Join(rowText(row), ","))
+	}
+	want := "cds of label,南京,,,,status 500|cds,江苏,苏州大学,CAS2,healthy,timeout"
+	if sheet.Name != errorSheet || strings.Join(rows, "|") != want {
+		t.Errorf("got sheet %s rows %q", sheet.Name, rows)
+	}
+}
+
+func TestFetchFailures_StageFailed(t *testing.T) {
+	// cds of every label fail, the ratio 2/3 is below the threshold 1 but the report would be empty
+	f := new(fetchFailures)
+	f.add(stageLabels, "", nil, nil)
+	f.add(stageCDSList, "南京", nil, errors.New("timeout"))
+	f.add(stageCDSList, "江苏", nil, errors.New("timeout"))
+	if err := f.exceeds(1); err == nil || !strings.Contains(err.Error(), stageCDSList) {
+		t.Errorf("exceeds(1) got %v", err)
+	}
+
+	// nem nodes of the nem report fail
+	f = new(fetchFailures)
+	f.add(stageLabels, "", nil, nil)
+	f.add(stageCDSList, "南京", nil, nil)
+	f.add(stageData, "", nil, errors.New("status 500"))
+	if err := f.exceeds(1); err == nil || !strings.Contains(err.Error(), stageData) {
+		t.Errorf("exceeds(1) got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/super1-chen/fxoss/history"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	historyDir     = "history"
+	sparklineWidth = 40
+)
+
+// sampleKey identifies a cds or a node, an icache node may have the same sn as its cds
+type sampleKey struct {
+	sn, kind string
+}
+
+// metric is a named value of history sample
+type metric struct {
+	name  string
+	value func(*history.Sample) int64
+}
+
+var (
+	cdsMetrics = []metric{
+		{"online_user", func(s *history.Sample) int64 { return s.OnlineUser }},
+		{"hit_user", func(s *history.Sample) int64 { return s.HitUser }},
+		{"service_kbps", func(s *history.Sample) int64 { return s.ServiceKbps }},
+		{"cache_kbps", func(s *history.Sample) int64 { return s.CacheKbps }},
+		{"monitor_kbps", func(s *history.Sample) int64 { return s.MonitorKbps }},
+	}
+	nodeMetrics = []metric{cdsMetrics[1], cdsMetrics[2], cdsMetrics[3]}
+)
+
+// Collect polls cds list every interval and saves metrics of cds and nodes into local history,
+// the interval of settings is used if interval is 0. It polls only once if once is true.
+func (oss *OSS) Collect(interval time.Duration, once bool) error {
+	if interval < 0 {
+		return fmt.Errorf("illegal interval %s", interval)
+	}
+	store, err := oss.historyStore()
+	if err != nil {
+		return err
+	}
+	if interval == 0 {
+		interval = oss.settings.History.interval
+	}
+	last, err := lastStatus(store, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		count, err := oss.collectOnce(store, last, now, interval)
+		if err != nil {
+			utils.ErrorPrintln(fmt.Sprintf("%s 采集失败: %v", now.Format(time.RFC3339), err), false)
+		} else {
+			oss.logger.Printf("collect %d samples at %s", count, now.Format(time.RFC3339))
+		}
+
+		h := oss.settings.History
+		if err = store.Compact(now, h.rawRetention, h.retention, h.resolution); err != nil {
+			oss.logger.Printf("compact history failed %v", err)
+		}
+
+		if once {
+			if err == nil {
+				utils.SuccessPrintln(fmt.Sprintf("采集%d条数据", count))
+			}
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case sig := <-sigs:
+			utils.ColorPrintln(fmt.Sprintf("receive signal %s, stop collecting", sig), utils.Yellow)
+			return nil
+		}
+	}
+}
+
+// ShowCDSHistory shows sparklines and min/avg/max/p95 of cds and its nodes metrics since now-since
+func (oss *OSS) ShowCDSHistory(now time.Time, sn string, since time.Duration) error {
+	store, err := oss.historyStore()
+	if err != nil {
+		return err
+	}
+	samples, err := store.Query(now.Add(-since), now, func(s *history.Sample) bool { return s.CDSSN == sn })
+	if err != nil {
+		return err
+	}
+
+	var cdsSamples []*history.Sample
+	nodeSamples := make(map[string][]*history.Sample)
+	for _, s := range samples {
+		if s.Kind == "cds" {
+			cdsSamples = append(cdsSamples, s)
+		} else {
+			nodeSamples[s.SN] = append(nodeSamples[s.SN], s)
+		}
+	}
+
+	if len(cdsSamples) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("History of CDS %q is empty, run `fxoss collect` first", sn), utils.Yellow)
+		return nil
+	}
+
+	first, last := cdsSamples[0], cdsSamples[len(cdsSamples)-1]
+	utils.SuccessPrintln(fmt.Sprintf("CDS %q %d samples from %s to %s, status %s", sn, len(cdsSamples),
+		first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339), last.Status))
+
+	headers := []string{"metric", "trend", "min", "avg", "max", "p95"}
+	var content [][]string
+	for _, m := range cdsMetrics {
+		content = append(content, append([]string{m.name}, metricSummary(cdsSamples, m)...))
+	}
+	utils.PrintTable(headers, content)
+
+	if len(nodeSamples) == 0 {
+		return nil
+	}
+
+	nodeSNs := make([]string, 0, len(nodeSamples))
+	for nodeSN := range nodeSamples {
+		nodeSNs = append(nodeSNs, nodeSN)
+	}
+	sort.Strings(nodeSNs)
+
+	utils.SuccessPrintln(fmt.Sprintf("CDS %q Nodes history", sn))
+	content = nil
+	for _, nodeSN := range nodeSNs {
+		ss := nodeSamples[nodeSN]
+		for _, m := range nodeMetrics {
+			row := []string{nodeSN, ss[len(ss)-1].Kind, m.name}
+			content = append(content, append(row, metricSummary(ss, m)...))
+		}
+	}
+	utils.PrintTable(append([]string{"sn", "type"}, headers...), content)
+	return nil
+}
+
+// collectOnce fetches cds list and appends samples of cds and nodes polled every interval to store,
+// status transitions between online and offline are recorded by comparing with last status.
+func (oss *OSS) collectOnce(store *history.Store, last map[sampleKey]string, now time.Time, interval time.Duration) (int, error) {
+	oss.ensureToken(now)
+	data, err := oss.listCDS()
+	if err != nil {
+		return 0, err
+	}
+
+	var samples []*history.Sample
+	for _, cds := range data.CDS {
+		samples = append(samples, &history.Sample{
+			Time:        now,
+			SN:          cds.SN,
+			CDSSN:       cds.SN,
+			Kind:        "cds",
+			Status:      cds.Status,
+			OnlineUser:  cds.OnlineUser,
+			HitUser:     cds.HitUser,
+			ServiceKbps: cds.ServiceKbps,
+			CacheKbps:   cds.CacheKbps,
+			MonitorKbps: cds.MonitorKbps,
+			Online:      onlineCount(cds.Status),
+			Interval:    interval,
+			Company:     cds.Company,
+		})
+		for _, node := range cds.Nodes {
+			samples = append(samples, &history.Sample{
+				Time:        now,
+				SN:          node.SN,
+				CDSSN:       cds.SN,
+				Kind:        node.Type,
+				Status:      node.Status,
+				HitUser:     node.HitUser,
+				ServiceKbps: node.ServiceKbps,
+				CacheKbps:   node.CacheKbps,
+				Online:      onlineCount(node.Status),
+				Interval:    interval,
+				Company:     cds.Company,
+			})
+		}
+	}
+
+	var transitions []*history.Transition
+	for _, s := range samples {
+		key := sampleKey{s.SN, s.Kind}
+		if prev, ok := last[key]; ok && utils.IsOnline(prev) != utils.IsOnline(s.Status) {
+			transitions = append(transitions, &history.Transition{
+				Time: now, SN: s.SN, CDSSN: s.CDSSN, Kind: s.Kind, From: prev, To: s.Status,
+			})
+		}
+		last[key] = s.Status
+	}
+
+	if err = store.Append(samples); err != nil {
+		return 0, err
+	}
+	return len(samples), store.AppendTransitions(transitions)
+}
+
+// lastStatus returns the latest status of every cds and node in store within one day
+func lastStatus(store *history.Store, now time.Time) (map[sampleKey]string, error) {
+	samples, err := store.Query(now.Add(-24*time.Hour), now, nil)
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[sampleKey]string)
+	for _, s := range samples {
+		last[sampleKey{s.SN, s.Kind}] = s.Status
+	}
+	return last, nil
+}
+
+func onlineCount(status string) int64 {
+	if utils.IsOnline(status) {
+		return 1
+	}
+	return 0
+}
+
+func (oss *OSS) historyStore() (*history.Store, error) {
+	if err := oss.settings.check("history"); err != nil {
+		return nil, err
+	}
+	return history.New(path.Join(confDir(), historyDir)), nil
+}
+
+// metricSummary returns trend, min, avg, max and p95 of the metric, avg and p95 are weighted by count of samples
+func metricSummary(samples []*history.Sample, m metric) []string {
+	values := make([]float64, 0, len(samples))
+	counts := make([]int64, 0, len(samples))
+	var sum float64
+	var total int64
+	for _, s := range samples {
+		v := float64(m.value(s))
+		values = append(values, v)
+		counts = append(counts, sampleCount(s))
+		// downsampled sample is weighted by the count of raw samples
+		sum += v * float64(sampleCount(s))
+		total += sampleCount(s)
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }
+	return []string{
+		utils.Sparkline(values, sparklineWidth),
+		format(sorted[0]),
+		format(sum / float64(total)),
+		format(sorted[len(sorted)-1]),
+		format(utils.WeightedPercentile(values, counts, 95)),
+	}
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// knownHostsJSON keeps ssh host keys of cds keyed by sn, host:port of tunnels is shared by cds
+// and changes, so it can not identify a cds like known_hosts of openssh.
+const knownHostsJSON = "known_hosts.json"
+
+// knownHost is the host key of a cds
+type knownHost struct {
+	Type   string    `json:"type"`
+	Key    string    `json:"key"`  // base64 of the public key
+	Addr   string    `json:"addr"` // host:port the key is learned from, empty if it is pinned
+	Added  time.Time `json:"added"`
+	Pinned bool      `json:"pinned"` // added by `fxoss hostkey pin`
+}
+
+type knownHosts map[string]*knownHost
+
+func newKnownHost(key ssh.PublicKey, addr string, now time.Time, pinned bool) *knownHost {
+	return &knownHost{Type: key.Type(), Key: base64.StdEncoding.EncodeToString(key.Marshal()), Addr: addr, Added: now, Pinned: pinned}
+}
+
+// fingerprint returns the SHA256 fingerprint of the key like ssh-keygen -l
+func (h *knownHost) fingerprint() string {
+	b, err := base64.StdEncoding.DecodeString(h.Key)
+	if err != nil {
+		return "illegal key"
+	}
+	key, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return "illegal key"
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// algorithms returns the host key algorithms to negotiate for the key
+func (h *knownHost) algorithms() []string {
+	if h.Type == ssh.KeyAlgoRSA {
+		return []string{ssh.SigAlgoRSASHA2512, ssh.SigAlgoRSASHA2256, ssh.SigAlgoRSA}
+	}
+	return []string{h.Type}
+}
+
+func (h *knownHost) source() string {
+	if h.Pinned {
+		return "pinned"
+	}
+	return "first use via " + h.Addr
+}
+
+func loadKnownHosts() (knownHosts, error) {
+	filename := path.Join(confDir(), knownHostsJSON)
+	hosts := make(knownHosts)
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return hosts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed %v", filename, err)
+	}
+	if err = json.Unmarshal(b, &hosts); err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed %v", filename, err)
+	}
+	return hosts, nil
+}
+
+func (k knownHosts) save() error {
+	filename := path.Join(confDir(), knownHostsJSON)
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal known hosts failed %v", err)
+	}
+	if err = ioutil.WriteFile(filename+".tmp", b, 0600); err != nil {
+		return fmt.Errorf("write %s failed %v", filename, err)
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// verify checks key offered by addr is the known key of cds sn. The key of an unknown cds
+// is trusted on first use, it is returned to be saved after the connection succeeds.
+// Times of the warning are shown in l.
+func (k knownHosts) verify(sn, addr string, key ssh.PublicKey, now time.Time, l *time.Location) (*knownHost, error) {
+	offered := newKnownHost(key, addr, now, false)
+	known, ok := k[sn]
+	if !ok {
+		return offered, nil
+	}
+	if known.Type == offered.Type && known.Key == offered.Key {
+		return nil, nil
+	}
+	return nil, fmt.Errorf(`@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@    WARNING: HOST KEY OF CDS %s HAS CHANGED!
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+Someone could be intercepting the tunnel to the cds, the connection is closed.
+known key:   %s %s (%s, %s)
+offered key: %s %s via %s
+Run `+"`fxoss hostkey forget %s`"+` if the host key of the cds is really changed.`,
+		sn, known.Type, known.fingerprint(), known.source(), known.Added.In(l).Format(reportTimeLayout),
+		offered.Type, offered.fingerprint(), addr, sn)
+}
+
+// hostKeyCallback verifies host keys of cds sn, a key trusted on first use is set to learned
+func hostKeyCallback(sn string, hosts knownHosts, learned **knownHost, l *time.Location) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		h, err := hosts.verify(sn, hostname, key, time.Now().UTC(), l)
+		if err != nil {
+			return err
+		}
+		*learned = h
+		return nil
+	}
+}
+
+// ShowHostKeys shows known host keys of cds
+func (oss *OSS) ShowHostKeys() error {
+	hosts, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+	var sns []string
+	for sn := range hosts {
+		sns = append(sns, sn)
+	}
+	sort.Strings(sns)
+
+	var content [][]string
+	for index, sn := range sns {
+		h := hosts[sn]
+		content = append(content, []string{fmt.Sprint(index + 1), sn, h.Type, h.fingerprint(), h.source(), h.Added.In(oss.settings.location).Format(reportTimeLayout)})
+	}
+	utils.PrintTable([]string{"#", "sn", "type", "fingerprint", "source", "added"}, content)
+	return nil
+}
+
+// ForgetHostKey removes the host key of cds sn, its key is trusted on next login
+func ForgetHostKey(sn string) error {
+	hosts, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+	h, ok := hosts[sn]
+	if !ok {
+		return fmt.Errorf("host key of cds %s is not found", sn)
+	}
+	delete(hosts, sn)
+	if err = hosts.save(); err != nil {
+		return err
+	}
+	utils.SuccessPrintln(fmt.Sprintf("已删除cds %s 的主机密钥 %s %s", sn, h.Type, h.fingerprint()))
+	return nil
+}
+
+// PinHostKey sets the host key of cds sn, key is a public key like ssh_host_*_key.pub or its file
+func PinHostKey(sn, key string) error {
+	b := []byte(key)
+	if _, err := os.Stat(key); err == nil {
+		if b, err = ioutil.ReadFile(key); err != nil {
+			return fmt.Errorf("read public key %s failed %v", key, err)
+		}
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return fmt.Errorf("parse public key failed %v", err)
+	}
+
+	hosts, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+	h := newKnownHost(pub, "", time.Now().UTC(), true)
+	if old, ok := hosts[sn]; ok && (old.Key != h.Key || old.Type != h.Type) {
+		utils.ColorPrintln(fmt.Sprintf("替换cds %s 的主机密钥 %s %s", sn, old.Type, old.fingerprint()), utils.Yellow)
+	}
+	hosts[sn] = h
+	if err = hosts.save(); err != nil {
+		return err
+	}
+	utils.SuccessPrintln(fmt.Sprintf("已固定cds %s 的主机密钥 %s %s", sn, h.Type, h.fingerprint()))
+	return nil
+}
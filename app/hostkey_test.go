@@ -0,0 +1,211 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/super1-chen/fxoss/logger"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKnownHosts_Verify(t *testing.T) {
+	now := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	key, other := testHostKey(t), testHostKey(t)
+	hosts := make(knownHosts)
+
+	h, err := hosts.verify("CAS1", "frp:6001", key, now, time.UTC)
+	if err != nil || h == nil || h.Addr != "frp:6001" || h.Pinned || h.fingerprint() != ssh.FingerprintSHA256(key) {
+		t.Fatalf("first use got %+v %v", h, err)
+	}
+	hosts["CAS1"] = h
+
+	// the same key via another port of the shared tunnel
+	if h, err := hosts.verify("CAS1", "frp:6002", key, now, time.UTC); h != nil || err != nil {
+		t.Errorf("known key got %+v %v", h, err)
+	}
+	// another cds behind the port the key is learned from
+	if h, err := hosts.verify("CAS2", "frp:6001", other, now, time.UTC); h == nil || err != nil {
+		t.Errorf("first use of another cds got %+v %v", h, err)
+	}
+	_, err = hosts.verify("CAS1", "frp:6001", other, now, time.UTC)
+	if err == nil || !strings.Contains(err.Error(), "HOST KEY OF CDS CAS1 HAS CHANGED") ||
+		!strings.Contains(err.Error(), ssh.FingerprintSHA256(other)) || !strings.Contains(err.Error(), "fxoss hostkey forget CAS1") {
+		t.Errorf("changed key got %v", err)
+	}
+}
+
+func TestPinHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	key := testHostKey(t)
+	if err = PinHostKey("CAS1", string(ssh.MarshalAuthorizedKey(key))); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := loadKnownHosts()
+	if err != nil || hosts["CAS1"] == nil || !hosts["CAS1"].Pinned {
+		t.Fatalf("got hosts %v %v", hosts, err)
+	}
+	if h, err := hosts.verify("CAS1", "frp:6001", key, time.Now(), time.UTC); h != nil || err != nil {
+		t.Errorf("pinned key got %+v %v", h, err)
+	}
+	if _, err = hosts.verify("CAS1", "frp:6001", testHostKey(t), time.Now(), time.UTC); err == nil {
+		t.Errorf("other key than the pinned one should fail")
+	}
+	if err = PinHostKey("CAS1", "not a key"); err == nil {
+		t.Errorf("illegal key should fail")
+	}
+
+	if err = ForgetHostKey("CAS1"); err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ = loadKnownHosts(); len(hosts) != 0 {
+		t.Errorf("got hosts %v after forget", hosts)
+	}
+	if err = ForgetHostKey("CAS1"); err == nil {
+		t.Errorf("forget unknown cds should fail")
+	}
+}
+
+// sshStub accepts ssh connections with any password and closes them after the handshake
+func sshStub(t *testing.T) (addr string, setKey func(...ssh.Signer), closeFn func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var signers []ssh.Signer
+	setKey = func(s ...ssh.Signer) {
+		mu.Lock()
+		defer mu.Unlock()
+		signers = s
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			config := &ssh.ServerConfig{PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil }}
+			mu.Lock()
+			for _, signer := range signers {
+				config.AddHostKey(signer)
+			}
+			mu.Unlock()
+			go func() {
+				defer conn.Close()
+				if _, chans, reqs, err := ssh.NewServerConn(conn, config); err == nil {
+					go ssh.DiscardRequests(reqs)
+					for ch := range chans {
+						ch.Reject(ssh.Prohibited, "stub")
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), setKey, func() { l.Close() }
+}
+
+func testHostSigner(t *testing.T) ssh.Signer {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSSHClient_HostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	addr, setKey, closeFn := sshStub(t)
+	defer closeFn()
+	host, portText, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portText)
+	oss := &OSS{SSHUser: "root", logger: logger.Mylogger(false), settings: &settings{location: time.UTC}}
+
+	first := testHostSigner(t)
+	setKey(first)
+	c, err := oss.sshClient("CAS1", host, "pwd", port, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	hosts, _ := loadKnownHosts()
+	if h := hosts["CAS1"]; h == nil || h.fingerprint() != ssh.FingerprintSHA256(first.PublicKey()) || h.Addr != addr {
+		t.Fatalf("key should be trusted on first use, got %+v", h)
+	}
+
+	if c, err = oss.sshClient("CAS1", host, "pwd", port, 1, 5); err != nil {
+		t.Fatalf("known key got %v", err)
+	}
+	c.Close()
+
+	// another cds behind the same tunnel port is not confused with CAS1
+	setKey(testHostSigner(t))
+	if _, err = oss.sshClient("CAS1", host, "pwd", port, 1, 5); err == nil || !strings.Contains(err.Error(), "HAS CHANGED") {
+		t.Errorf("changed key got %v", err)
+	}
+	if c, err = oss.sshClient("CAS2", host, "pwd", port, 1, 5); err != nil {
+		t.Fatalf("first use of CAS2 got %v", err)
+	}
+	c.Close()
+	if hosts, _ = loadKnownHosts(); len(hosts) != 2 || hosts["CAS1"].Key == hosts["CAS2"].Key {
+		t.Errorf("got hosts %+v", hosts)
+	}
+
+	// a cds with several host keys offers the known one, not the one preferred by the library
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSigner, err := ssh.NewSignerFromKey(edPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setKey(testHostSigner(t), edSigner)
+	if err = PinHostKey("CAS3", string(ssh.MarshalAuthorizedKey(edSigner.PublicKey()))); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = oss.sshClient("CAS3", host, "pwd", port, 1, 5); err != nil {
+		t.Fatalf("pinned ed25519 key got %v", err)
+	}
+	c.Close()
+}
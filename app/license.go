@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// ShowCDSLicense shows cds whose license expires within the given duration,
+// it returns the count of these cds.
+func (oss *OSS) ShowCDSLicense(now time.Time, within time.Duration) (int, error) {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return 0, err
+	}
+
+	results := oss.expiringLicenses(data.CDS, now, within)
+	if len(results) == 0 {
+		utils.SuccessPrintln(fmt.Sprintf("No cds license expires within %s", within))
+		return 0, nil
+	}
+
+	headers := []string{"#", "company", "sn", "status", "license_end", "days_left"}
+	var content [][]string
+	for index, ret := range results {
+		index++
+		days := strconv.FormatInt(ret.daysLeft, 10)
+		if ret.daysLeft < 0 {
+			// highlight expired license
+			days = utils.ColorText(days+"(expired)", utils.Red)
+		}
+		content = append(content, []string{
+			strconv.Itoa(index),
+			ret.company,
+			ret.sn,
+			ret.status,
+			ret.licenseEndAt,
+			days,
+		})
+	}
+	utils.PrintTable(headers, content)
+
+	return len(results), nil
+}
+
+// expiringLicenses filters cds whose license expires before now+within,
+// results are grouped by company and sorted by days left.
+func (oss *OSS) expiringLicenses(cdsList []*cdsInfo, now time.Time, within time.Duration) []*licenseResult {
+	var results []*licenseResult
+	minDays := make(map[string]int64)
+
+	for _, cds := range cdsList {
+		expireAt, err := utils.ParseTime(cds.LicenseEndAt, oss.settings.location)
+		if err != nil {
+			oss.logger.Printf("skip cds %s license: %v", cds.SN, err)
+			continue
+		}
+		if expireAt.After(now.Add(within)) {
+			continue
+		}
+		ret := &licenseResult{
+			sn:           cds.SN,
+			company:      cds.Company,
+			status:       cds.Status,
+			licenseEndAt: cds.LicenseEndAt,
+			expireAt:     expireAt,
+			daysLeft:     daysLeft(expireAt, now),
+		}
+		if days, ok := minDays[ret.company]; !ok || ret.daysLeft < days {
+			minDays[ret.company] = ret.daysLeft
+		}
+		results = append(results, ret)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.company != b.company {
+			if minDays[a.company] != minDays[b.company] {
+				return minDays[a.company] < minDays[b.company]
+			}
+			return a.company < b.company
+		}
+		if a.daysLeft != b.daysLeft {
+			return a.daysLeft < b.daysLeft
+		}
+		return a.sn < b.sn
+	})
+	return results
+}
+
+// daysLeft returns whole days from now to t, it is negative after t
+func daysLeft(t, now time.Time) int64 {
+	return int64(math.Floor(t.Sub(now).Hours() / 24))
+}
@@ -1,26 +1,28 @@
 package app
 
+import "time"
+
 type cdsInfo struct {
-	SN             string `json:"sn"`
-	Company        string `json:"company"`
-	Status         string `json:"status"`
-	LicenseStartAt string `json:"license_start_at"`
-	LicenseEndAt   string `json:"license_end_at"`
-	OnlineUser     int64  `json:"online_user"`
-	OnlineUserMax  int64  `json:"online_user_max"`
-	OnlineUserStr  string
-	HitUser        int64  `json:"hit_user"`
-	HitUserMax     int64  `json:"hit_user_max"`
-	HitUserStr     string `json:"hit_user_str"`
-	ServiceKbps    int64  `json:"service_kbps"`
-	ServiceKbpsMax int64  `json:"service_kbps_max"`
-	ServiceStr     string
-	CacheKbps      int64 `json:"cache_kbps"`
-	CacheKbpsMax   int64 `json:"cache_kbps_max"`
-	CacheStr       string
-	MonitorKbps    int64 `json:"monitor_kbps"`
-	MonitorKbpsMax int64 `json:"monitor_kbps_max"`
-	MonitorStr     string
+	SN             string  `json:"sn"`
+	Company        string  `json:"company"`
+	Status         string  `json:"status"`
+	LicenseStartAt string  `json:"license_start_at"`
+	LicenseEndAt   string  `json:"license_end_at"`
+	OnlineUser     int64   `json:"online_user"`
+	OnlineUserMax  int64   `json:"online_user_max"`
+	OnlineUserStr  string  `json:"-"`
+	HitUser        int64   `json:"hit_user"`
+	HitUserMax     int64   `json:"hit_user_max"`
+	HitUserStr     string  `json:"hit_user_str"`
+	ServiceKbps    int64   `json:"service_kbps"`
+	ServiceKbpsMax int64   `json:"service_kbps_max"`
+	ServiceStr     string  `json:"-"`
+	CacheKbps      int64   `json:"cache_kbps"`
+	CacheKbpsMax   int64   `json:"cache_kbps_max"`
+	CacheStr       string  `json:"-"`
+	MonitorKbps    int64   `json:"monitor_kbps"`
+	MonitorKbpsMax int64   `json:"monitor_kbps_max"`
+	MonitorStr     string  `json:"-"`
 	Version        string  `json:"version"`
 	UpdatedAt      string  `json:"updated_at"`
 	Nodes          []*node `json:"nodes"`
@@ -41,6 +43,7 @@ type node struct {
 	ServiceKbpsMax int64  `json:"service_kbps_max"`
 	CacheKbps      int64  `json:"cache_kbps"`
 	CacheKbpsMax   int64  `json:"cache_kbps_max"`
+	UpdatedAt      string `json:"updated_at"`
 }
 
 type cdsList struct {
@@ -74,7 +77,29 @@ type portInfo struct {
 type emailConf struct {
 	Address    string `json:"address"`
 	Password   string `json:"password"`
-	SMTPServer string `json:"smtp_server"`
+	SMTPServer string `json:"smtp_server"` // host or host:port
+	Port       int    `json:"port"`
+	Security   string `json:"security"` // tls, starttls, none, or empty for tls on port 465 and starttls if offered
+	Auth       string `json:"auth"`     // plain, login, cram-md5 or none, default plain
+	Username   string `json:"username"` // default address
+	FromName   string `json:"from_name"`
+	SkipVerify bool   `json:"insecure_skip_verify"`
+	Timeout    string `json:"timeout"`
+
+	// report email
+	Subject     string   `json:"subject"`     // text/template with .Date and .Env
+	Environment string   `json:"environment"` // .Env of subject, default host of oss api
+	CC          []string `json:"cc"`
+	BCC         []string `json:"bcc"`
+	ReplyTo     string   `json:"reply_to"`
+
+	// recipients
+	Groups         map[string][]string `json:"groups"`          // members of @group, members can be @group
+	AllowedDomains []string            `json:"allowed_domains"` // default fxdata.cn and ifeixiang.com, "*" allows any
+
+	host    string
+	port    int
+	timeout time.Duration
 }
 
 type disk struct {
@@ -83,11 +108,20 @@ type disk struct {
 	RS     string `json:"rs"`
 	Size   string `json:"size"`
 	Status int64  `json:"status"`
-	Used   string `json:"usesd"`
+	Used   string `json:"used"`
+	Usesd  string `json:"usesd"` // misspelled key returned by old api
 	Util   string `json:"util"`
 	WS     string `json:"ws"`
 }
 
+// used returns used size of disk whichever key the api returns
+func (d *disk) used() string {
+	if d.Used != "" {
+		return d.Used
+	}
+	return d.Usesd
+}
+
 type disks struct {
 	Disk []*disk `json:"disks"`
 }
@@ -99,14 +133,17 @@ type cdsDiskInfo struct {
 	Name       string `json:"name"`
 	ReadSpeed  string `json:"rs"`
 	Size       string `json:"size"`
-	DiskUsed   string `json: "used"`
+	DiskUsed   string `json:"used"`
 	Util       string `json:"util"`
-	WriteSpeed string `json: "ws"`
+	WriteSpeed string `json:"ws"`
 }
 
 type diskTypeResult struct {
-	domain, sn, company, status, userAndSpeed string
-	user, speed, diskType                     int64
+	domain, sn, company, status string
+	user, speed, diskType       int64
+	diskSize                    float64
+	diskErr                     error
+	cds                         *cdsInfo
 }
 
 type nemNode struct {
@@ -120,3 +157,65 @@ type nemNode struct {
 type nemNodeList struct {
 	List []*nemNode `jons:"list"`
 }
+
+type licenseResult struct {
+	sn, company, status, licenseEndAt string
+	expireAt                          time.Time
+	daysLeft                          int64
+}
+
+type staleResult struct {
+	kind, sn, cdsSN, company, status, updatedAt string
+	age                                         time.Duration
+	known                                       bool
+}
+
+type capacityResult struct {
+	cds      *cdsInfo
+	ratio    float64 // worst ratio of service, cache and monitor
+	measured bool    // false if the cds reports no max of any bandwidth
+	online   bool
+}
+
+type diskHealthResult struct {
+	cds      *cdsInfo
+	disk     *disk
+	problems []string
+}
+
+type snapshot struct {
+	CreatedAt time.Time            `json:"created_at"`
+	CDS       []*cdsInfo           `json:"cds"`
+	Labels    []*snapshotLabel     `json:"labels"`
+	Ports     map[string]*portInfo `json:"ports"`
+	NemNodes  []*nemNode           `json:"nem_nodes"`
+	// PortErrors keeps errors of cds whose ports can not be fetched keyed by sn,
+	// their ports are unknown rather than removed
+	PortErrors map[string]string `json:"port_errors,omitempty"`
+}
+
+type snapshotLabel struct {
+	ID   int64    `json:"id"`
+	Name string   `json:"name"`
+	SN   []string `json:"sn"`
+}
+
+type snapshotChange struct {
+	kind, sn, before, after string
+}
+
+type billingResult struct {
+	name, company  string
+	cdsCount       int
+	p95, peak, avg float64 // kbps
+	samples        int64
+	coverage       float64
+}
+
+type slaResult struct {
+	sn, cdsSN, kind, company string
+	observed, downtime, gap  time.Duration
+	gaps                     int
+	outages                  []time.Duration
+	source                   string
+}
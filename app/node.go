@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var nodeHeaders = []string{"sn", "type", "status", "hit_user(max)", "cache_kbps(max)", "service_kbps(max)"}
+
+// ShowNodeList shows nodes of all cds, nodes are filtered by type and status if given
+func (oss *OSS) ShowNodeList(nodeType, status string) error {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	headers := append([]string{"#", "cds_sn", "company"}, nodeHeaders...)
+	content := nodeListRows(data.CDS, nodeType, status)
+	if len(content) == 0 {
+		utils.ColorPrintln("Nodes list is empty", utils.Yellow)
+		return nil
+	}
+	utils.PrintTable(headers, content)
+	return nil
+}
+
+// nodeListRows flattens nodes of all cds into rows, nodes are filtered by type and status if given
+func nodeListRows(cdsList []*cdsInfo, nodeType, status string) [][]string {
+	var content [][]string
+	for _, cds := range cdsList {
+		for _, node := range cds.Nodes {
+			if nodeType != "" && !strings.EqualFold(node.Type, nodeType) {
+				continue
+			}
+			if status != "" && utils.StatusKind(node.Status) != strings.ToLower(status) {
+				continue
+			}
+			row := append([]string{strconv.Itoa(len(content) + 1), cds.SN, cds.Company}, nodeRow(node)...)
+			content = append(content, row)
+		}
+	}
+	return content
+}
+
+// ShowNodeDetail finds the parent cds of the node sn and shows metrics of the node
+func (oss *OSS) ShowNodeDetail(sn string) error {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	cds, node := findNode(data.CDS, sn)
+	if node == nil {
+		return fmt.Errorf("node %q is not found in any cds", sn)
+	}
+
+	utils.SuccessPrintln(fmt.Sprintf("Node %q belongs to CDS %q", node.SN, cds.SN))
+	utils.PrintTable(
+		[]string{"company", "cds_sn", "cds_status", "version", "updated_at"},
+		[][]string{{cds.Company, cds.SN, cds.Status, cds.Version, cds.UpdatedAt}},
+	)
+	utils.PrintTable(nodeHeaders, [][]string{nodeRow(node)})
+	return nil
+}
+
+// findNode finds the node and its parent cds by node sn
+func findNode(cdsList []*cdsInfo, sn string) (*cdsInfo, *node) {
+	for _, cds := range cdsList {
+		for _, node := range cds.Nodes {
+			if strings.EqualFold(node.SN, sn) {
+				return cds, node
+			}
+		}
+	}
+	return nil, nil
+}
+
+func nodeRow(node *node) []string {
+	return []string{
+		node.SN,
+		node.Type,
+		node.Status,
+		utils.FormatItem(node.HitUser, node.HitUserMax),
+		utils.FormatItem(node.CacheKbps, node.CacheKbpsMax),
+		utils.FormatItem(node.ServiceKbps, node.ServiceKbpsMax),
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func testNodeCDS() []*cdsInfo {
+	return []*cdsInfo{
+		{SN: "CAS1", Company: "南京农业大学", Nodes: []*node{
+			{SN: "ICA1", Type: "icache", Status: "healthy"},
+			{SN: "NEM1", Type: "nem", Status: "offline"},
+		}},
+		{SN: "CAS2", Company: "苏州大学"},
+		{SN: "CAS3", Company: "东南大学", Nodes: []*node{
+			{SN: "ICA3", Type: "icache", Status: "warn: disk full"},
+		}},
+	}
+}
+
+func TestFindNode(t *testing.T) {
+	testCases := []struct {
+		sn, wantCDS, wantNode string
+	}{
+		{"ICA3", "CAS3", "ICA3"},
+		{"nem1", "CAS1", "NEM1"},
+		{"CAS1", "", ""}, // cds is not a node
+		{"ICA9", "", ""},
+	}
+	for _, c := range testCases {
+		cds, n := findNode(testNodeCDS(), c.sn)
+		var gotCDS, gotNode string
+		if cds != nil {
+			gotCDS = cds.SN
+		}
+		if n != nil {
+			gotNode = n.SN
+		}
+		if gotCDS != c.wantCDS || gotNode != c.wantNode {
+			t.Errorf("findNode(%q) got %q %q != want %q %q", c.sn, gotCDS, gotNode, c.wantCDS, c.wantNode)
+		}
+	}
+}
+
+func TestNodeListRows(t *testing.T) {
+	testCases := []struct {
+		nodeType, status string
+		want             string
+	}{
+		{"", "", "1 CAS1 ICA1|2 CAS1 NEM1|3 CAS3 ICA3"},
+		{"ICACHE", "", "1 CAS1 ICA1|2 CAS3 ICA3"},
+		{"", "warn", "1 CAS3 ICA3"},
+		{"nem", "healthy", ""},
+	}
+	for _, c := range testCases {
+		var rows []string
+		for _, row := range nodeListRows(testNodeCDS(), c.nodeType, c.status) {
+			rows = append(rows, strings.Join([]string{row[0], row[1], row[3]}, " "))
+		}
+		if got := strings.Join(rows, "|"); got != c.want {
+			t.Errorf("nodeListRows(%q, %q) got %q != want %q", c.nodeType, c.status, got, c.want)
+		}
+	}
+}
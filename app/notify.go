@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/super1-chen/fxoss/logger"
+	"github.com/super1-chen/fxoss/notify"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// Notify sends title and markdown text to the named notifiers of settings,
+// payloads are printed instead of sent if dryRun is true.
+func Notify(names []string, dryRun, verbose bool, title, text string) error {
+	oss := &OSS{logger: logger.Mylogger(verbose)}
+	s, err := oss.loadSettings()
+	if err != nil {
+		return err
+	}
+	oss.settings = s
+	oss.SetNotify(names, dryRun)
+	return oss.notify(&notify.Message{Title: title, Text: text, Time: time.Now().UTC()})
+}
+
+// SetNotify sets notifiers used by long running commands such as `alerts run`
+func (oss *OSS) SetNotify(names []string, dryRun bool) {
+	oss.notifyNames, oss.dryRun = names, dryRun
+}
+
+// notify sends message to every notifier set, it tries all notifiers even if some fail
+func (oss *OSS) notify(m *notify.Message) error {
+	var failed []string
+	for _, name := range oss.notifyNames {
+		conf, ok := oss.settings.Notifiers[name]
+		if !ok {
+			return fmt.Errorf("notifier %q is not found in %s", name, settingsJSON)
+		}
+		n, err := notify.New(name, conf)
+		if err != nil {
+			return err
+		}
+
+		if oss.dryRun {
+			payload, err := n.Payload(m)
+			if err != nil {
+				return err
+			}
+			utils.ColorPrintln(fmt.Sprintf("[dry-run] notifier %s POST %s", name, endpoint(conf.URL)), utils.Yellow)
+			fmt.Println(string(payload))
+			continue
+		}
+
+		if err = n.Send(m); err != nil {
+			oss.logger.Printf("%v", err)
+			failed = append(failed, name)
+			continue
+		}
+		oss.logger.Printf("send message %q to notifier %s", m.Title, name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("发送通知失败: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// endpoint removes query of url which may contain access token
+func endpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+)
+
+const emailJSON = "fx_email.json"
+
+// defaultAllowedDomains are domains of recipients if allowed_domains of fx_email.json is empty
+var defaultAllowedDomains = []string{"fxdata.cn", "ifeixiang.com"}
+
+// ValidateRecipients checks addresses and members of @groups of fx_email.json are allowed
+// before any request, fx_email.json is not required to be complete.
+func ValidateRecipients(addresses []string) error {
+	filename := path.Join(confDir(), emailJSON)
+	conf := new(emailConf)
+	if _, err := os.Stat(filename); err == nil {
+		if conf, err = readEmailConfig(filename); err != nil {
+			return err
+		}
+	}
+	_, err := conf.recipients(addresses)
+	return err
+}
+
+// readEmailConfig reads fx_email.json without defaults
+func readEmailConfig(filename string) (*emailConf, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read email config failed: %v", err)
+	}
+	conf := new(emailConf)
+	if err = json.Unmarshal(b, conf); err != nil {
+		return nil, fmt.Errorf("json unmarshal %s failed %v", filename, err)
+	}
+	return conf, nil
+}
+
+// recipients expands @group of addresses to its members, groups can include other groups.
+// Every address should be of allowed domains, duplicated addresses are removed.
+func (c *emailConf) recipients(addresses []string) ([]string, error) {
+	var list []string
+	seen := make(map[string]bool)
+
+	var expand func(addresses []string, groups []string) error
+	expand = func(addresses []string, groups []string) error {
+		for _, address := range addresses {
+			address = strings.TrimSpace(address)
+			if strings.HasPrefix(address, "@") {
+				name := address[1:]
+				members, ok := c.Groups[name]
+				if !ok {
+					return fmt.Errorf("recipient group %s is not found in groups of %s", address, emailJSON)
+				}
+				for _, g := range groups {
+					if g == name {
+						return fmt.Errorf("recipient group %s includes itself", address)
+					}
+				}
+				if err := expand(members, append(groups, name)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.allowed(address); err != nil {
+				if len(groups) > 0 {
+					return fmt.Errorf("%v, it is in group @%s", err, strings.Join(groups, " > @"))
+				}
+				return err
+			}
+			if key := strings.ToLower(address); !seen[key] {
+				seen[key] = true
+				list = append(list, address)
+			}
+		}
+		return nil
+	}
+
+	if err := expand(addresses, nil); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// allowed checks address is a plain email address of allowed domains or their sub domains,
+// "*" allows any domain.
+func (c *emailConf) allowed(address string) error {
+	if addr, err := mail.ParseAddress(address); err != nil || addr.Address != address {
+		return fmt.Errorf("illegal email address %q", address)
+	}
+	domains := c.AllowedDomains
+	if len(domains) == 0 {
+		domains = defaultAllowedDomains
+	}
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "@"))
+		if d == "*" || domain == d || strings.HasSuffix(domain, "."+d) {
+			return nil
+		}
+	}
+	return fmt.Errorf("email address %q is not allowed, its domain should be one of %s", address, strings.Join(domains, ", "))
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEmailConf_Recipients(t *testing.T) {
+	conf := &emailConf{Groups: map[string][]string{
+		"ops":         {"a@fxdata.cn", "b@ifeixiang.com"},
+		"sales-north": {"c@fxdata.cn", "@ops"},
+		"bad":         {"@ops", "x@gmail.com"},
+		"loop":        {"@loop2"},
+		"loop2":       {"@loop"},
+	}}
+
+	got, err := conf.recipients([]string{"@sales-north", "A@fxdata.cn", "d@mail.fxdata.cn"})
+	if err != nil || strings.Join(got, ",") != "c@fxdata.cn,a@fxdata.cn,b@ifeixiang.com,d@mail.fxdata.cn" {
+		t.Errorf("got recipients %v %v", got, err)
+	}
+
+	for _, c := range []struct {
+		addresses []string
+		want      string
+	}{
+		{[]string{"someone@ifeixiang.com.cn"}, `"someone@ifeixiang.com.cn" is not allowed`},
+		{[]string{"@ifeixiang.com"}, "group @ifeixiang.com is not found"},
+		{[]string{"a@fxdata.cn", "@bad"}, `"x@gmail.com" is not allowed, its domain should be one of fxdata.cn, ifeixiang.com, it is in group @bad`},
+		{[]string{"@loop"}, "group @loop includes itself"},
+		{[]string{"Someone <s@fxdata.cn>"}, "illegal email address"},
+	} {
+		if _, err := conf.recipients(c.addresses); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("recipients(%v) got error %v, want %q", c.addresses, err, c.want)
+		}
+	}
+
+	conf.AllowedDomains = []string{"*"}
+	if _, err := conf.recipients([]string{"@bad"}); err != nil {
+		t.Errorf("any domain should be allowed, got %v", err)
+	}
+	conf.AllowedDomains = []string{"@gmail.com"}
+	if _, err := conf.recipients([]string{"a@fxdata.cn"}); err == nil {
+		t.Errorf("fxdata.cn should not be allowed")
+	}
+}
+
+func TestValidateRecipients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	if err = ValidateRecipients([]string{"a@fxdata.cn"}); err != nil {
+		t.Errorf("default domains without %s got %v", emailJSON, err)
+	}
+	ioutil.WriteFile(path.Join(dir, emailJSON), []byte(`{"groups": {"ops": ["x@example.com"]}, "allowed_domains": ["example.com"]}`), 0644)
+	if err = ValidateRecipients([]string{"@ops"}); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err = ValidateRecipients([]string{"a@fxdata.cn"}); err == nil {
+		t.Errorf("fxdata.cn should not be allowed")
+	}
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// reportKind is a type of report in the registry, it declares data it fetches and sheets it makes
+type reportKind struct {
+	name, title, description string
+	// fetchCDS fetches data of a cds of labels in the worker pool, nil if the cds list of labels is enough
+	fetchCDS func(oss *OSS, r *diskTypeResult) error
+	// fetch fetches data besides cds of labels, such as nem nodes
+	fetch  func(oss *OSS, d *reportData) error
+	sheets func(d *reportData) []*reportSheet
+	// fileName is the report file name without extension, default <name>-<date>
+	fileName func(now time.Time) string
+	// summary sends the disk type summary with changes since the last report as email body instead of sheets
+	summary bool
+	// compare adds a sheet comparing with the last archived report
+	compare bool
+}
+
+// reportData is data fetched for a report
+type reportData struct {
+	now      time.Time
+	labels   map[string][]*diskTypeResult // cds of labels keyed by label name
+	nemNodes []*nemNode
+	failures *fetchFailures
+	location *time.Location // time zone of times returned by oss api
+}
+
+var reportKinds = make(map[string]*reportKind)
+
+// registerReport adds a report type to the registry
+func registerReport(k *reportKind) {
+	if _, ok := reportKinds[k.name]; ok {
+		panic(fmt.Sprintf("report type %s is registered twice", k.name))
+	}
+	reportKinds[k.name] = k
+}
+
+// ShowReportTypes shows report types of the registry
+func ShowReportTypes() error {
+	var names []string
+	for name := range reportKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content [][]string
+	for index, name := range names {
+		k := reportKinds[name]
+		content = append(content, []string{fmt.Sprint(index + 1), k.name, k.title, k.description})
+	}
+	utils.PrintTable([]string{"#", "type", "title", "description"}, content)
+	return nil
+}
+
+// RunReport generates the report of type name like ReportCDS
+func (oss *OSS) RunReport(now time.Time, name string, opts ReportOptions, toList ...string) error {
+	kind, ok := reportKinds[name]
+	if !ok {
+		return fmt.Errorf("report type %q is not found, see `fxoss report list`", name)
+	}
+	return oss.runReport(now, kind, opts, toList...)
+}
+
+// runReport fetches data of kind, renders its sheets of opts.Format, and sends the report to toList
+// and archives it with its data, or keeps it without email at opts.Output or in the config dir
+// if opts.NoEmail is true. Failed fetches are listed in the errors sheet and returned as an error,
+// the report is not sent if they reach opts.FailThreshold or all fetches of a stage failed.
+func (oss *OSS) runReport(now time.Time, kind *reportKind, opts ReportOptions, toList ...string) error {
+
+	if err := oss.settings.check("report"); err != nil {
+		return err
+	}
+	if opts.FailThreshold < 0 || opts.FailThreshold > 1 {
+		return fmt.Errorf("illegal fail threshold %v, it should be in [0, 1]", opts.FailThreshold)
+	}
+	formatName, format, err := reportFormatOf(opts.Format, opts.Output)
+	if err != nil {
+		return err
+	}
+	keep := opts.Output != "" || opts.NoEmail || len(toList) == 0
+	toUsers := strings.Join(toList, ",")
+
+	root := confDir()
+	if !keep {
+		// the report is rendered in a temp directory and moved into the archive after it is sent
+		root, err = ioutil.TempDir(confDir(), ".report-")
+		if err != nil {
+			return fmt.Errorf("create temp dir of report failed %v", err)
+		}
+		defer os.RemoveAll(root)
+	}
+	l := oss.settings.location
+	reportName := fmt.Sprintf("%s-%s", kind.name, now.In(l).Format("2006-01-02"))
+	if kind.fileName != nil {
+		reportName = kind.fileName(now)
+	}
+	reportName += format.ext
+	reportPath := path.Join(root, reportName)
+	if opts.Output != "" {
+		reportPath = opts.Output
+	}
+
+	utils.ColorPrintln("开始提取数据", utils.Yellow)
+
+	data := oss.fetchReportData(now, kind)
+
+	var previous *reportArchive
+	if kind.summary || kind.compare {
+		previous, err = loadPreviousArchive(kind.name, now)
+		if err != nil {
+			oss.logger.Printf("load previous report failed %v", err)
+			utils.ErrorPrintln("读取上次报告失败, 不比较变更", false)
+		}
+	}
+
+	sheets := kind.sheets(data)
+	if kind.compare && previous != nil {
+		sheets = append(sheets, comparisonSheet(previous.results(), data.labels))
+	}
+	if sheet := data.failures.sheet(); sheet != nil {
+		sheets = append(sheets, sheet)
+	}
+	failed, total := data.failures.count()
+	if failed > 0 {
+		utils.ErrorPrintln(fmt.Sprintf("%d/%d 次数据获取失败, 详见报告的%s表", failed, total, errorSheet), false)
+	}
+
+	utils.ColorPrintln(fmt.Sprintf("开始创建%s报告: %s", formatName, reportPath), utils.Yellow)
+
+	err = writeReport(reportPath, format, sheets)
+	if err != nil {
+		oss.logger.Println(err)
+		utils.ErrorPrintln(fmt.Sprintf("创建报告%s失败", reportPath), false)
+		return data.failures.wrap(err)
+	}
+
+	if keep {
+		if abs, err := filepath.Abs(reportPath); err == nil {
+			reportPath = abs
+		}
+		if opts.NoEmail && len(toList) > 0 {
+			utils.ColorPrintln("dry run, 未发送邮件给: "+toUsers, utils.Yellow)
+		}
+		utils.SuccessPrintln("报告已保存: " + reportPath)
+		return data.failures.err()
+	}
+
+	if err = data.failures.exceeds(opts.FailThreshold); err != nil {
+		utils.ErrorPrintln("数据获取失败过多, 未发送邮件给: "+toUsers, false)
+		return err
+	}
+
+	summary := &reportSummary{Date: now.In(l).Format("2006-01-02"), sheets: sheets}
+	if kind.summary {
+		summary = summarizeReport(data.labels, previous, now, l, "")
+	}
+	summary.Title = kind.title
+	summary.Failures, summary.Fetches = failed, total
+
+	utils.ColorPrintln("开始发送邮件给: "+toUsers, utils.Yellow)
+
+	err = oss.sendEmail(reportPath, summary, opts, toList...)
+	if err != nil {
+		utils.ErrorPrintln(fmt.Sprintf("发送email%s给%q失败", reportName, toUsers), false)
+		oss.logger.Println(err)
+		return data.failures.wrap(fmt.Errorf("send report %s to %s failed %v", reportName, toUsers, err))
+	}
+
+	utils.SuccessPrintln("发送邮件成至用户:" + toUsers)
+	if opts.sent != nil {
+		opts.sent()
+	}
+
+	archiveName := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(reportName, format.ext), now.In(l).Format("150405"), format.ext)
+	if err = archiveReport(reportPath, newReportArchive(kind.name, now, archiveName, data), l); err != nil {
+		oss.logger.Printf("archive report failed %v", err)
+		utils.ErrorPrintln("归档报告失败", false)
+	} else {
+		utils.SuccessPrintln("报告已归档: " + path.Join(reportArchivePath(now, l), archiveName))
+	}
+	removed, err := pruneReportArchive(now, oss.settings.Report.retention, l)
+	if err != nil {
+		oss.logger.Printf("prune report archive failed %v", err)
+	}
+	if len(removed) > 0 {
+		oss.logger.Printf("remove report archive of %s", strings.Join(removed, ","))
+	}
+	return data.failures.err()
+}
+
+// fetchReportData fetches cds of labels through the label and worker pool pipeline, then data of kind,
+// failed fetches are counted in failures of the data
+func (oss *OSS) fetchReportData(now time.Time, kind *reportKind) *reportData {
+	in := make(chan *label)      // without cds list information
+	out := make(chan *label, 20) // with cds information
+
+	d := &reportData{now: now, location: oss.settings.location, failures: new(fetchFailures)}
+	go oss.fetchCDSByLabel(in, out, d.failures)
+	go oss.fetchLabels(in, d.failures)
+	d.labels = oss.fetchDiskTypeResult(out, kind.fetchCDS, d.failures)
+
+	if kind.fetch != nil {
+		err := kind.fetch(oss, d)
+		if err != nil {
+			oss.logger.Printf("fetch data of report %s failed %v", kind.name, err)
+		}
+		d.failures.add(stageData, "", nil, err)
+	}
+	return d
+}
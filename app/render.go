@@ -0,0 +1,408 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/tealeg/xlsx"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	reportHeaders  = []string{"Customer Name", "SN", "Max Online Users", "Service Max Mbps", "Status", "Device Type", "Disk Capacity"}
+	summaryHeaders = []string{"Label", "Devices", "Online", "Offline", "Max Online Users", "Service Max Mbps"}
+)
+
+const (
+	summarySheet = "Summary"
+	errorSheet   = "Errors"
+	// maxSheetName is the max length of sheet names of excel
+	maxSheetName = 31
+)
+
+// reportFormat renders report sheets into a file of the format
+type reportFormat struct {
+	ext    string
+	render func(w io.Writer, sheets []*reportSheet) error
+}
+
+var reportFormats = map[string]*reportFormat{
+	"xlsx":     {".xlsx", renderXLSX},
+	"csv":      {".csv", renderCSV},
+	"html":     {".html", renderHTML},
+	"markdown": {".md", renderMarkdown},
+	"json":     {".json", renderJSON},
+}
+
+// reportSheet is a table of a report, cells are strings or numbers
+type reportSheet struct {
+	Name    string
+	Headers []string
+	Rows    [][]interface{}
+	// Offline marks rows of offline devices, they are coloured in xlsx
+	Offline []bool
+
+	label bool // named after a label, it is renamed in xlsx if the name clashes with other sheets
+}
+
+// ReportFormats returns names of report formats
+func ReportFormats() []string {
+	var names []string
+	for name := range reportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reportFormatOf returns the format of name, the format is guessed by extension of output
+// if name is empty, and it is xlsx if the extension is unknown.
+func reportFormatOf(name, output string) (string, *reportFormat, error) {
+	if name == "" {
+		ext := strings.ToLower(filepath.Ext(output))
+		for n, f := range reportFormats {
+			if f.ext == ext || (n == "markdown" && ext == ".markdown") {
+				return n, f, nil
+			}
+		}
+		name = "xlsx"
+	}
+	f, ok := reportFormats[strings.ToLower(name)]
+	if !ok {
+		return "", nil, fmt.Errorf("illegal format %q, it should be one of %s", name, strings.Join(ReportFormats(), ", "))
+	}
+	return strings.ToLower(name), f, nil
+}
+
+// diskTypeSheets makes a summary sheet of labels and a sheet of every label sorted by sn
+func diskTypeSheets(data map[string][]*diskTypeResult) []*reportSheet {
+	summary := &reportSheet{Name: summarySheet, Headers: summaryHeaders}
+	sheets := []*reportSheet{summary}
+
+	var devices, online, users, speed int64
+	seen := make(map[string]bool)
+	for _, name := range sortedLabels(data) {
+		sheet := &reportSheet{Name: name, Headers: reportHeaders, label: true}
+		var lOnline, lUsers, lSpeed int64
+		for _, r := range sortedResults(data[name]) {
+			isOnline := utils.IsOnline(r.status)
+			sheet.Rows = append(sheet.Rows, r.row())
+			sheet.Offline = append(sheet.Offline, !isOnline)
+			if isOnline {
+				lOnline++
+			}
+			lUsers += r.user
+			lSpeed += r.speed
+
+			if seen[r.sn] {
+				continue
+			}
+			seen[r.sn] = true
+			devices++
+			if isOnline {
+				online++
+			}
+			users += r.user
+			speed += r.speed
+		}
+		lDevices := int64(len(data[name]))
+		summary.Rows = append(summary.Rows, []interface{}{name, lDevices, lOnline, lDevices - lOnline, lUsers, kbpsToMbps(lSpeed)})
+		sheets = append(sheets, sheet)
+	}
+	// devices of several labels are counted once in total
+	summary.Rows = append(summary.Rows, []interface{}{"Total", devices, online, devices - online, users, kbpsToMbps(speed)})
+	return sheets
+}
+
+func sortedLabels(data map[string][]*diskTypeResult) []string {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedResults(results []*diskTypeResult) []*diskTypeResult {
+	sorted := make([]*diskTypeResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].sn < sorted[j].sn })
+	return sorted
+}
+
+// diskText returns device type and disk capacity, they are unknown if disks could not be fetched
+func (r *diskTypeResult) diskText() (diskType, diskSize string) {
+	if r.diskErr != nil {
+		return "unknown", "unknown"
+	}
+	diskSize = "-"
+	if r.diskSize > 0 {
+		diskSize = utils.FormatSize(r.diskSize)
+	}
+	return strconv.Itoa(int(r.diskType)), diskSize
+}
+
+// row returns values of reportHeaders, device type is a number unless it is unknown
+func (r *diskTypeResult) row() []interface{} {
+	diskType, diskSize := r.diskText()
+	row := []interface{}{r.company, r.sn, r.user, kbpsToMbps(r.speed), r.status, diskType, diskSize}
+	if r.diskErr == nil {
+		row[5] = r.diskType
+	}
+	return row
+}
+
+// cellText formats a cell for text formats
+func cellText(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func rowText(row []interface{}) []string {
+	values := make([]string, len(row))
+	for i, v := range row {
+		values[i] = cellText(v)
+	}
+	return values
+}
+
+// writeReport renders sheets of format into filename
+func writeReport(filename string, format *reportFormat, sheets []*reportSheet) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create report %s failed %v", filename, err)
+	}
+	if err = format.render(f, sheets); err != nil {
+		f.Close()
+		return fmt.Errorf("render report %s failed %v", filename, err)
+	}
+	return f.Close()
+}
+
+// renderXLSX writes every sheet as a sheet of workbook with a frozen header row,
+// autofilter and column widths fitting cells, rows of offline devices are coloured.
+func renderXLSX(w io.Writer, sheets []*reportSheet) error {
+	file := xlsx.NewFile()
+	hStyle := headerStyle()
+	oStyle := offlineStyle()
+
+	names := xlsxSheetNames(sheets)
+	for n, s := range sheets {
+		sheet, err := file.AddSheet(names[n])
+		if err != nil {
+			return fmt.Errorf("create new sheet %s %v", names[n], err)
+		}
+
+		widths := make([]int, len(s.Headers))
+		row := sheet.AddRow()
+		for i, item := range s.Headers {
+			cell := row.AddCell()
+			cell.SetStyle(hStyle)
+			cell.Value = item
+			// header font is bigger than cells
+			widths[i] = runewidth.StringWidth(item) * 3 / 2
+		}
+		for i, values := range s.Rows {
+			row = sheet.AddRow()
+			offline := i < len(s.Offline) && s.Offline[i]
+			for j, v := range values {
+				cell := row.AddCell()
+				cell.SetValue(v)
+				if offline {
+					cell.SetStyle(oStyle)
+				}
+				if j < len(widths) {
+					if n := runewidth.StringWidth(cellText(v)); n > widths[j] {
+						widths[j] = n
+					}
+				}
+			}
+		}
+
+		if len(s.Headers) == 0 {
+			continue
+		}
+		sheet.SheetViews = []xlsx.SheetView{{Pane: &xlsx.Pane{YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft", State: "frozen"}}}
+		sheet.AutoFilter = &xlsx.AutoFilter{TopLeftCell: "A1", BottomRightCell: xlsx.GetCellIDStringFromCoords(len(s.Headers)-1, len(s.Rows))}
+		for i, width := range widths {
+			if width < minColWidth {
+				width = minColWidth
+			} else if width > maxColWidth {
+				width = maxColWidth
+			}
+			sheet.SetColWidth(i, i, float64(width+2))
+		}
+	}
+	return file.Write(w)
+}
+
+const (
+	minColWidth = 8
+	maxColWidth = 60
+)
+
+var sheetNameReplacer = strings.NewReplacer("[", "_", "]", "_", ":", "_", "*", "_", "?", "_", "/", "_", `\`, "_")
+
+// xlsxSheetNames returns names of sheets allowed by excel: at most 31 characters without []:*?/\
+// and unique ignoring case. Sheets named after labels get a suffix such as ` (2)` if their names clash,
+// so fixed sheets such as Summary and Errors keep their names.
+func xlsxSheetNames(sheets []*reportSheet) []string {
+	truncate := func(name string, n int) string {
+		if r := []rune(name); len(r) > n {
+			return string(r[:n])
+		}
+		return name
+	}
+	names := make([]string, len(sheets))
+	used := make(map[string]bool)
+	for _, label := range []bool{false, true} {
+		for i, s := range sheets {
+			if s.label != label {
+				continue
+			}
+			base := strings.Trim(sheetNameReplacer.Replace(s.Name), "'")
+			if base == "" {
+				base = "Sheet"
+			}
+			name := truncate(base, maxSheetName)
+			for n := 2; used[strings.ToLower(name)]; n++ {
+				suffix := fmt.Sprintf(" (%d)", n)
+				name = truncate(base, maxSheetName-len(suffix)) + suffix
+			}
+			used[strings.ToLower(name)] = true
+			names[i] = name
+		}
+	}
+	return names
+}
+
+// offlineStyle fills cells of offline devices with light red
+func offlineStyle() *xlsx.Style {
+	style := xlsx.NewStyle()
+	style.Fill = *xlsx.NewFill("solid", "FFFFC7CE", "FFFFC7CE")
+	style.Font.Color = "FF9C0006"
+	style.ApplyFill = true
+	style.ApplyFont = true
+	return style
+}
+
+// renderCSV writes rows of all sheets with a leading sheet name column,
+// a sheet with headers different from the last one starts with its own header line.
+func renderCSV(w io.Writer, sheets []*reportSheet) error {
+	cw := csv.NewWriter(w)
+	var headers []string
+	for _, s := range sheets {
+		if strings.Join(s.Headers, "\x00") != strings.Join(headers, "\x00") {
+			headers = s.Headers
+			cw.Write(append([]string{"Sheet"}, headers...))
+		}
+		for _, row := range s.Rows {
+			cw.Write(append([]string{s.Name}, rowText(row)...))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// renderMarkdown writes a table of every sheet
+func renderMarkdown(w io.Writer, sheets []*reportSheet) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	for i, s := range sheets {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "## %s\n\n", s.Name)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(s.Headers, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(s.Headers)))
+		for _, values := range s.Rows {
+			row := rowText(values)
+			for j := range row {
+				row[j] = escape.Replace(row[j])
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+	}
+	return nil
+}
+
+// renderHTML writes a page with a table of every sheet
+func renderHTML(w io.Writer, sheets []*reportSheet) error {
+	type htmlTable struct {
+		Name    string
+		Headers []string
+		Rows    [][]string
+	}
+	var data []htmlTable
+	for _, s := range sheets {
+		t := htmlTable{Name: s.Name, Headers: s.Headers}
+		for _, row := range s.Rows {
+			t.Rows = append(t.Rows, rowText(row))
+		}
+		data = append(data, t)
+	}
+	return reportPage.Execute(w, data)
+}
+
+// reportJSONSheet is a sheet of json report, rows are objects keyed by headers
+type reportJSONSheet struct {
+	Name    string                   `json:"name"`
+	Headers []string                 `json:"headers"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// renderJSON writes sheets, numbers of cells are kept
+func renderJSON(w io.Writer, sheets []*reportSheet) error {
+	data := make([]*reportJSONSheet, 0, len(sheets))
+	for _, s := range sheets {
+		js := &reportJSONSheet{Name: s.Name, Headers: s.Headers, Rows: []map[string]interface{}{}}
+		for _, row := range s.Rows {
+			obj := make(map[string]interface{})
+			for i, v := range row {
+				if i < len(s.Headers) {
+					obj[s.Headers[i]] = v
+				}
+			}
+			js.Rows = append(js.Rows, obj)
+		}
+		data = append(data, js)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"sheets": data})
+}
+
+var reportPage = htmlTemplate.Must(htmlTemplate.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+body { font-family: Arial, sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+th { background: #f0f0f0; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}}</h2>
+<table>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+func TestReportFormatOf(t *testing.T) {
+	testCases := []struct {
+		format, output, want string
+	}{
+		{"", "", "xlsx"},
+		{"", "/tmp/cds.csv", "csv"},
+		{"", "cds.md", "markdown"},
+		{"", "cds.MARKDOWN", "markdown"},
+		{"", "cds.txt", "xlsx"},
+		{"JSON", "cds.csv", "json"},
+		{"html", "", "html"},
+	}
+	for _, c := range testCases {
+		got, _, err := reportFormatOf(c.format, c.output)
+		if err != nil || got != c.want {
+			t.Errorf("reportFormatOf(%q, %q) got %q %v != want %q", c.format, c.output, got, err, c.want)
+		}
+	}
+	if _, _, err := reportFormatOf("pdf", ""); err == nil {
+		t.Errorf("unknown format should return error")
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	sheets := diskTypeSheets(reportTestData())
+	render := func(format string) string {
+		buf := new(bytes.Buffer)
+		if err := reportFormats[format].render(buf, sheets); err != nil {
+			t.Fatalf("render %s error %v", format, err)
+		}
+		return buf.String()
+	}
+
+	csv := strings.Split(strings.TrimSpace(render("csv")), "\n")
+	if len(csv) != 9 || csv[0] != "Sheet,Label,Devices,Online,Offline,Max Online Users,Service Max Mbps" ||
+		csv[3] != "Summary,Total,3,2,1,105,3.5" ||
+		csv[4] != "Sheet,Customer Name,SN,Max Online Users,Service Max Mbps,Status,Device Type,Disk Capacity" ||
+		csv[8] != "江苏,苏州大学,CAS0530000300,5,0.5,warn: icache offline,unknown,unknown" {
+		t.Errorf("got csv %q", csv)
+	}
+
+	md := render("markdown")
+	if !strings.Contains(md, "## 南京\n\n| Customer Name |") || !strings.Contains(md, "| 南京航空航天大学 | CAS0530000231 |") {
+		t.Errorf("got markdown %s", md)
+	}
+
+	html := render("html")
+	if strings.Count(html, "<table>") != 3 || !strings.Contains(html, "<td>苏州大学</td>") {
+		t.Errorf("got html %s", html)
+	}
+
+	var ret struct {
+		Sheets []*reportJSONSheet `json:"sheets"`
+	}
+	if err := json.Unmarshal([]byte(render("json")), &ret); err != nil {
+		t.Fatal(err)
+	}
+	if len(ret.Sheets) != 3 || ret.Sheets[2].Name != "江苏" || ret.Sheets[2].Rows[1]["Device Type"] != "unknown" ||
+		ret.Sheets[1].Rows[0]["Device Type"] != float64(1000) || ret.Sheets[1].Rows[0]["Service Max Mbps"] != float64(2) {
+		t.Errorf("got json %+v", ret.Sheets)
+	}
+
+	file, err := xlsx.OpenBinary([]byte(render("xlsx")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Sheets) != 3 || file.Sheets[0].Name != "Summary" || file.Sheets[1].Rows[1].Cells[1].Value != "CAS0530000102" {
+		t.Errorf("got xlsx sheets %d", len(file.Sheets))
+	}
+}
+
+func TestRenderXLSX_Style(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := renderXLSX(buf, diskTypeSheets(reportTestData())); err != nil {
+		t.Fatal(err)
+	}
+	file, err := xlsx.OpenBinary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := file.Sheets[1]
+	if len(sheet.SheetViews) == 0 || sheet.SheetViews[0].Pane == nil || sheet.SheetViews[0].Pane.State != "frozen" {
+		t.Errorf("header of sheet %s should be frozen", sheet.Name)
+	}
+	for i, col := range sheet.Cols {
+		if col.Width < minColWidth || col.Width > maxColWidth+2 {
+			t.Errorf("got width %v of column %d", col.Width, i)
+		}
+	}
+	if sheet.Cols[0].Width < float64(len("南京航空航天大学"))*2/3 {
+		t.Errorf("column should fit company names, got width %v", sheet.Cols[0].Width)
+	}
+	offline := sheet.Rows[2]
+	if offline.Cells[1].Value != "CAS0530000231" || offline.Cells[0].GetStyle().Fill.FgColor != "FFFFC7CE" {
+		t.Errorf("offline row should be coloured, got %+v", offline.Cells[0].GetStyle().Fill)
+	}
+	if sheet.Rows[1].Cells[0].GetStyle().Fill.PatternType == "solid" {
+		t.Errorf("online row should not be coloured")
+	}
+	if typ := sheet.Rows[1].Cells[3].Type(); typ != xlsx.CellTypeNumeric {
+		t.Errorf("speed should be numeric, got %v", typ)
+	}
+
+	// autofilter is not read back by xlsx
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		if f.Name != "xl/worksheets/sheet2.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		content, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if !strings.Contains(string(content), `<autoFilter ref="A1:G3"`) {
+			t.Errorf("got sheet %s", content)
+		}
+	}
+}
+
+func TestRenderCSV_Headers(t *testing.T) {
+	sheets := []*reportSheet{
+		{Name: "a", Headers: []string{"x"}, Rows: [][]interface{}{{1.5}}},
+		{Name: "b", Headers: []string{"x"}, Rows: [][]interface{}{{int64(2)}}},
+		{Name: "c", Headers: []string{"y", "z"}, Rows: [][]interface{}{{"v", nil}}},
+	}
+	buf := new(bytes.Buffer)
+	if err := renderCSV(buf, sheets); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "Sheet,x\na,1.5\nb,2\nSheet,y,z\nc,v,\n"; got != want {
+		t.Errorf("got csv %q != want %q", got, want)
+	}
+}
+
+func TestXLSXSheetNames(t *testing.T) {
+	long := strings.Repeat("江苏", 20)
+	sheets := []*reportSheet{
+		{Name: summarySheet},
+		{Name: "summary", label: true},
+		{Name: "a/b:c[1]?", label: true},
+		{Name: long, label: true},
+		{Name: long + "x", label: true},
+		{Name: "'", label: true},
+		{Name: errorSheet},
+	}
+	want := []string{"Summary", "summary (2)", "a_b_c_1__", string([]rune(long)[:31]), string([]rune(long)[:27]) + " (2)", "Sheet", "Errors"}
+
+	got := xlsxSheetNames(sheets)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("xlsxSheetNames got %q != want %q", got, want)
+	}
+	buf := new(bytes.Buffer)
+	if err := renderXLSX(buf, sheets); err != nil {
+		t.Errorf("renderXLSX failed %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	htmlTemplate "html/template"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/scorredoira/email"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+const (
+	defaultReportSubject = "[{{.Env}}] {{.Title}} {{.Date}}"
+	reportTimeLayout     = "2006-01-02 15:04"
+)
+
+// ReportOptions are options of the report given on command line
+type ReportOptions struct {
+	CC, BCC []string
+	ReplyTo string
+	Format  string // one of ReportFormats, guessed by extension of Output if it is empty
+	Output  string // keep the report at Output without email
+	NoEmail bool   // keep the report in config dir without email
+	// FailThreshold is the ratio of failed fetches in [0, 1] which aborts sending, 0 aborts on any failure
+	FailThreshold float64
+	// sent is called after the report is sent by email
+	sent func()
+}
+
+// reportDevice is a device of a report, a device in several labels is reported once
+type reportDevice struct {
+	SN        string   `json:"sn"`
+	Company   string   `json:"company"`
+	Status    string   `json:"status"`
+	Labels    []string `json:"labels"`
+	DiskType  string   `json:"disk_type"`
+	SpeedKbps int64    `json:"speed_kbps"`
+}
+
+type labelSummary struct {
+	Name                     string
+	Devices, Online, Offline int
+	Users                    int64
+	Bandwidth                string
+}
+
+type tierSummary struct {
+	Tier   string
+	Counts []int // counts of every status of reportSummary.Statuses
+	Total  int
+}
+
+type reportChange struct {
+	Kind, SN, Company, Labels, Before, After string
+}
+
+// reportSummary is the data of report email templates, the body is sheets of the report
+// instead of the summary if sheets is not nil
+type reportSummary struct {
+	Date, Env      string
+	Title          string
+	Devices        int
+	Bandwidth      string
+	Labels         []*labelSummary
+	Statuses       []string
+	Tiers          []*tierSummary
+	Changes        []*reportChange
+	FirstReport    bool
+	PreviousReport string
+	Failures       int // failed fetches of Fetches
+	Fetches        int
+	devices        []*reportDevice
+	sheets         []*reportSheet
+}
+
+// summarizeReport summarizes report data by label, tier and status, and compares devices with
+// the previous report if previous is not nil. Dates are shown in l.
+func summarizeReport(data map[string][]*diskTypeResult, previous *reportArchive, now time.Time, l *time.Location, env string) *reportSummary {
+	s := &reportSummary{Date: now.In(l).Format("2006-01-02"), Env: env, FirstReport: previous == nil}
+
+	var total int64
+	for name, results := range data {
+		l := &labelSummary{Name: name}
+		var speed int64
+		for _, r := range results {
+			l.Devices++
+			if utils.IsOnline(r.status) {
+				l.Online++
+			} else {
+				l.Offline++
+			}
+			l.Users += r.user
+			speed += r.speed
+		}
+		l.Bandwidth = formatKbps(speed)
+		total += speed
+		s.Labels = append(s.Labels, l)
+	}
+	sort.Slice(s.Labels, func(i, j int) bool { return s.Labels[i].Name < s.Labels[j].Name })
+
+	s.devices = reportDevices(data)
+	s.Devices, s.Bandwidth = len(s.devices), formatKbps(total)
+
+	counts := make(map[string]map[string]int)
+	statuses := make(map[string]bool)
+	for _, d := range s.devices {
+		status := utils.StatusKind(d.Status)
+		if status == "" {
+			status = "unknown"
+		}
+		statuses[status] = true
+		if counts[d.DiskType] == nil {
+			counts[d.DiskType] = make(map[string]int)
+		}
+		counts[d.DiskType][status]++
+	}
+	for status := range statuses {
+		s.Statuses = append(s.Statuses, status)
+	}
+	sort.Strings(s.Statuses)
+	for tier, byStatus := range counts {
+		t := &tierSummary{Tier: tier}
+		for _, status := range s.Statuses {
+			t.Counts = append(t.Counts, byStatus[status])
+			t.Total += byStatus[status]
+		}
+		s.Tiers = append(s.Tiers, t)
+	}
+	sort.Slice(s.Tiers, func(i, j int) bool { return tierLess(s.Tiers[i].Tier, s.Tiers[j].Tier) })
+
+	if previous != nil {
+		s.PreviousReport = previous.Time.In(l).Format(reportTimeLayout)
+		s.Changes = diffReportDevices(reportDevices(previous.results()), s.devices)
+	}
+	return s
+}
+
+// reportDevices merges results of labels into devices sorted by sn
+func reportDevices(data map[string][]*diskTypeResult) []*reportDevice {
+	bySN := make(map[string]*reportDevice)
+	for name, results := range data {
+		for _, r := range results {
+			d, ok := bySN[r.sn]
+			if !ok {
+				d = &reportDevice{SN: r.sn, Company: r.company, Status: r.status, DiskType: "unknown", SpeedKbps: r.speed}
+				if r.diskErr == nil {
+					d.DiskType = strconv.Itoa(int(r.diskType))
+				}
+				bySN[r.sn] = d
+			}
+			d.Labels = append(d.Labels, name)
+		}
+	}
+
+	devices := make([]*reportDevice, 0, len(bySN))
+	for _, d := range bySN {
+		sort.Strings(d.Labels)
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].SN < devices[j].SN })
+	return devices
+}
+
+// diffReportDevices finds new and removed devices, and devices whose online status or tier changed,
+// a tier change from or to unknown is ignored since it means disks could not be fetched.
+func diffReportDevices(before, after []*reportDevice) []*reportChange {
+	var changes []*reportChange
+	old := make(map[string]*reportDevice)
+	for _, d := range before {
+		old[d.SN] = d
+	}
+	add := func(kind string, d *reportDevice, b, a string) {
+		changes = append(changes, &reportChange{Kind: kind, SN: d.SN, Company: d.Company, Labels: strings.Join(d.Labels, ","), Before: b, After: a})
+	}
+
+	for _, d := range after {
+		o, ok := old[d.SN]
+		delete(old, d.SN)
+		if !ok {
+			add("new", d, "", d.Status)
+			continue
+		}
+		if utils.IsOnline(o.Status) != utils.IsOnline(d.Status) {
+			add("status", d, o.Status, d.Status)
+		}
+		if o.DiskType != d.DiskType && o.DiskType != "unknown" && d.DiskType != "unknown" {
+			add("tier", d, o.DiskType, d.DiskType)
+		}
+	}
+	for _, d := range before {
+		if _, ok := old[d.SN]; ok {
+			add("removed", d, d.Status, "")
+		}
+	}
+	return changes
+}
+
+// tierLess sorts tiers by number and unknown last
+func tierLess(a, b string) bool {
+	x, errX := strconv.Atoi(a)
+	y, errY := strconv.Atoi(b)
+	if errX != nil || errY != nil {
+		return errX == nil || (errY != nil && a < b)
+	}
+	return x < y
+}
+
+func formatKbps(kbps int64) string {
+	return fmt.Sprintf("%.1fMbps", float64(kbps)/1024)
+}
+
+// reportEnv is the environment name in report subjects, default the host of oss api
+func (oss *OSS) reportEnv(conf *emailConf) string {
+	if conf.Environment != "" {
+		return conf.Environment
+	}
+	if u, err := url.Parse(oss.Host); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return oss.Host
+}
+
+// newReportMessage renders subject and html and plain text body of the report email
+func newReportMessage(conf *emailConf, s *reportSummary, opts ReportOptions, toList []string) (*email.Message, error) {
+	subject := new(bytes.Buffer)
+	t, err := textTemplate.New("subject").Parse(conf.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("parse subject template failed %v", err)
+	}
+	if err = t.Execute(subject, s); err != nil {
+		return nil, fmt.Errorf("render subject failed %v", err)
+	}
+
+	html, text := new(bytes.Buffer), new(bytes.Buffer)
+	if s.sheets != nil {
+		err = renderHTML(html, s.sheets)
+	} else {
+		err = reportHTML.Execute(html, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("render html body failed %v", err)
+	}
+	if s.sheets != nil {
+		err = renderMarkdown(text, s.sheets)
+	} else {
+		err = reportText.Execute(text, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("render text body failed %v", err)
+	}
+
+	contentType, body, err := alternativeBody(text.String(), html.String())
+	if err != nil {
+		return nil, err
+	}
+	m := email.NewMessage(strings.TrimSpace(subject.String()), body)
+	m.BodyContentType = contentType
+	if m.To, err = conf.recipients(toList); err != nil {
+		return nil, err
+	}
+	if m.Cc, err = conf.recipients(append(append([]string{}, conf.CC...), opts.CC...)); err != nil {
+		return nil, fmt.Errorf("cc: %v", err)
+	}
+	if m.Bcc, err = conf.recipients(append(append([]string{}, conf.BCC...), opts.BCC...)); err != nil {
+		return nil, fmt.Errorf("bcc: %v", err)
+	}
+	m.ReplyTo = conf.ReplyTo
+	if opts.ReplyTo != "" {
+		m.ReplyTo = opts.ReplyTo
+	}
+	return m, nil
+}
+
+// alternativeBody builds a multipart/alternative body of plain text and html,
+// mail clients show the last part they support.
+func alternativeBody(text, html string) (contentType, body string, err error) {
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", text},
+		{"text/html", html},
+	} {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", part.contentType+"; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "base64")
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return "", "", fmt.Errorf("create %s part failed %v", part.contentType, err)
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(part.content))
+		for len(encoded) > 76 {
+			fmt.Fprintf(pw, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(pw, "%s\r\n", encoded)
+	}
+	if err = w.Close(); err != nil {
+		return "", "", err
+	}
+	return "multipart/alternative; boundary=" + w.Boundary(), buf.String(), nil
+}
+
+var reportHTML = htmlTemplate.Must(htmlTemplate.New("report").Parse(`<html>
+<head><meta charset="utf-8"></head>
+<body style="font-family: Arial, sans-serif; font-size: 14px;">
+<h2>{{.Env}} {{.Title}} {{.Date}}</h2>
+<p>设备总数 <b>{{.Devices}}</b>，带宽峰值合计 <b>{{.Bandwidth}}</b>，详情见附件。</p>
+{{if .Failures}}<p style="color: #c00;">{{.Failures}}/{{.Fetches}} 次数据获取失败，详见附件的 Errors 表。</p>
+{{end}}{{$th := "border: 1px solid #ccc; padding: 4px 8px; background: #f0f0f0;"}}{{$td := "border: 1px solid #ccc; padding: 4px 8px;"}}
+<h3>标签汇总</h3>
+<table style="border-collapse: collapse;">
+<tr><th style="{{$th}}">label</th><th style="{{$th}}">devices</th><th style="{{$th}}">online</th><th style="{{$th}}">offline</th><th style="{{$th}}">users</th><th style="{{$th}}">bandwidth</th></tr>
+{{range .Labels}}<tr><td style="{{$td}}">{{.Name}}</td><td style="{{$td}}">{{.Devices}}</td><td style="{{$td}}">{{.Online}}</td><td style="{{$td}}{{if .Offline}} color: #c00;{{end}}">{{.Offline}}</td><td style="{{$td}}">{{.Users}}</td><td style="{{$td}}">{{.Bandwidth}}</td></tr>
+{{end}}</table>
+<h3>设备类型及状态</h3>
+<table style="border-collapse: collapse;">
+<tr><th style="{{$th}}">device type</th>{{range .Statuses}}<th style="{{$th}}">{{.}}</th>{{end}}<th style="{{$th}}">total</th></tr>
+{{range .Tiers}}<tr><td style="{{$td}}">{{.Tier}}</td>{{range .Counts}}<td style="{{$td}}">{{.}}</td>{{end}}<td style="{{$td}}">{{.Total}}</td></tr>
+{{end}}</table>
+<h3>变更</h3>
+{{if .FirstReport}}<p>首次报告，没有可比较的上次报告。</p>
+{{else if not .Changes}}<p>自上次报告 ({{.PreviousReport}}) 以来没有变更。</p>
+{{else}}<p>自上次报告 ({{.PreviousReport}}) 以来的变更：</p>
+<table style="border-collapse: collapse;">
+<tr><th style="{{$th}}">change</th><th style="{{$th}}">sn</th><th style="{{$th}}">company</th><th style="{{$th}}">labels</th><th style="{{$th}}">before</th><th style="{{$th}}">after</th></tr>
+{{range .Changes}}<tr><td style="{{$td}}">{{.Kind}}</td><td style="{{$td}}">{{.SN}}</td><td style="{{$td}}">{{.Company}}</td><td style="{{$td}}">{{.Labels}}</td><td style="{{$td}}">{{.Before}}</td><td style="{{$td}}">{{.After}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+var reportText = textTemplate.Must(textTemplate.New("report").Parse(`{{.Env}} {{.Title}} {{.Date}}
+
+设备总数 {{.Devices}}，带宽峰值合计 {{.Bandwidth}}，详情见附件。
+{{if .Failures}}{{.Failures}}/{{.Fetches}} 次数据获取失败，详见附件的 Errors 表。
+{{end}}
+标签汇总 (label: devices, online, offline, users, bandwidth)
+{{range .Labels}}- {{.Name}}: {{.Devices}}, {{.Online}}, {{.Offline}}, {{.Users}}, {{.Bandwidth}}
+{{end}}
+设备类型及状态 (device type: {{range .Statuses}}{{.}}, {{end}}total)
+{{range .Tiers}}- {{.Tier}}: {{range .Counts}}{{.}}, {{end}}{{.Total}}
+{{end}}
+变更
+{{if .FirstReport}}首次报告，没有可比较的上次报告。
+{{else if not .Changes}}自上次报告 ({{.PreviousReport}}) 以来没有变更。
+{{else}}自上次报告 ({{.PreviousReport}}) 以来的变更 (change sn company labels: before -> after):
+{{range .Changes}}- {{.Kind}} {{.SN}} {{.Company}} {{.Labels}}: {{.Before}} -> {{.After}}
+{{end}}{{end}}`))
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reportTestData() map[string][]*diskTypeResult {
+	cds := map[string]*cdsInfo{
+		"CAS0530000102": {SN: "CAS0530000102", Company: "南京农业大学", Status: "healthy", Version: "11.3.402", LicenseEndAt: "2026-11-01 00:00:00", OnlineUser: 80, OnlineUserMax: 100, ServiceKbps: 1024, ServiceKbpsMax: 2048},
+		"CAS0530000231": {SN: "CAS0530000231", Company: "南京航空航天大学", Status: "offline", Version: "11.3.402", LicenseEndAt: "2026-10-01 00:00:00", ServiceKbpsMax: 1024},
+		"CAS0530000300": {SN: "CAS0530000300", Company: "苏州大学", Status: "warn: icache offline", Version: "11.2.100", OnlineUser: 5, OnlineUserMax: 5, ServiceKbps: 512, ServiceKbpsMax: 512},
+	}
+	return map[string][]*diskTypeResult{
+		"南京": {
+			{domain: "南京", sn: "CAS0530000102", company: "南京农业大学", status: "healthy", user: 100, speed: 2048, diskType: 1000, cds: cds["CAS0530000102"]},
+			{domain: "南京", sn: "CAS0530000231", company: "南京航空航天大学", status: "offline", user: 0, speed: 1024, diskType: 500, cds: cds["CAS0530000231"]},
+		},
+		"江苏": {
+			{domain: "江苏", sn: "CAS0530000102", company: "南京农业大学", status: "healthy", user: 100, speed: 2048, diskType: 1000, cds: cds["CAS0530000102"]},
+			{domain: "江苏", sn: "CAS0530000300", company: "苏州大学", status: "warn: icache offline", user: 5, speed: 512, diskErr: errors.New("timeout"), cds: cds["CAS0530000300"]},
+		},
+	}
+}
+
+func TestSummarizeReport(t *testing.T) {
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	s := summarizeReport(reportTestData(), nil, now, time.FixedZone("CST", 8*3600), "oss")
+
+	if s.Date != "2026-10-19" || !s.FirstReport || s.Devices != 3 || s.Bandwidth != "5.5Mbps" {
+		t.Errorf("got date %s first %v devices %d bandwidth %s", s.Date, s.FirstReport, s.Devices, s.Bandwidth)
+	}
+	if len(s.Labels) != 2 || s.Labels[0].Name != "南京" || s.Labels[0].Online != 1 || s.Labels[0].Offline != 1 || s.Labels[0].Bandwidth != "3.0Mbps" {
+		t.Errorf("got label %+v", s.Labels[0])
+	}
+	if strings.Join(s.Statuses, ",") != "healthy,offline,warn" {
+		t.Errorf("got statuses %v", s.Statuses)
+	}
+	var tiers []string
+	for _, tier := range s.Tiers {
+		tiers = append(tiers, tier.Tier)
+	}
+	if strings.Join(tiers, ",") != "500,1000,unknown" || s.Tiers[1].Counts[0] != 1 || s.Tiers[2].Counts[2] != 1 {
+		t.Errorf("got tiers %v %+v", tiers, s.Tiers)
+	}
+	if d := s.devices[0]; d.SN != "CAS0530000102" || strings.Join(d.Labels, ",") != "南京,江苏" {
+		t.Errorf("got device %+v", d)
+	}
+}
+
+func TestDiffReportDevices(t *testing.T) {
+	before := []*reportDevice{
+		{SN: "A", Status: "healthy", DiskType: "1000"},
+		{SN: "B", Status: "healthy", DiskType: "500"},
+		{SN: "C", Status: "offline", DiskType: "500"},
+		{SN: "D", Status: "healthy", DiskType: "unknown"},
+	}
+	after := []*reportDevice{
+		{SN: "A", Status: "warn: icache offline", DiskType: "1000"},
+		{SN: "B", Status: "offline", DiskType: "1000"},
+		{SN: "D", Status: "healthy", DiskType: "2000"},
+		{SN: "E", Status: "healthy", DiskType: "500"},
+	}
+	var got []string
+	for _, c := range diffReportDevices(before, after) {
+		got = append(got, c.Kind+" "+c.SN+" "+c.Before+" "+c.After)
+	}
+	want := []string{"status B healthy offline", "tier B 500 1000", "new E  healthy", "removed C offline "}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got changes %q != want %q", got, want)
+	}
+}
+
+func TestNewReportMessage(t *testing.T) {
+	now := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	previous := &reportArchive{Time: now.AddDate(0, 0, -7), Labels: map[string][]*archivedResult{"南京": {{SN: "CAS0530000231", Status: "healthy", DiskType: 500}}}}
+	s := summarizeReport(reportTestData(), previous, now, time.FixedZone("CST", 8*3600), "oss.fxdata.cn")
+
+	s.Title = "cds 磁盘情况报告"
+	conf := &emailConf{Address: "robot@fxdata.cn", SMTPServer: "smtp", CC: []string{"boss@fxdata.cn"}, ReplyTo: "ops@fxdata.cn"}
+	if err := conf.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	opts := ReportOptions{CC: []string{"a@fxdata.cn"}, BCC: []string{"b@fxdata.cn"}, ReplyTo: "noc@fxdata.cn"}
+	m, err := newReportMessage(conf, s, opts, []string{"to@fxdata.cn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.From = conf.from()
+
+	if m.Subject != "[oss.fxdata.cn] cds 磁盘情况报告 2026-10-19" {
+		t.Errorf("got subject %q", m.Subject)
+	}
+	if strings.Join(m.Tolist(), ",") != "to@fxdata.cn,boss@fxdata.cn,a@fxdata.cn,b@fxdata.cn" || m.ReplyTo != "noc@fxdata.cn" {
+		t.Errorf("got recipients %v reply to %s", m.Tolist(), m.ReplyTo)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Errorf("bcc should not be in headers")
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %s %v", mediaType, err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	bodies := make(map[string]string)
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		bodies[ct] = string(b)
+	}
+	for _, ct := range []string{"text/plain", "text/html"} {
+		body := bodies[ct]
+		for _, want := range []string{"南京航空航天大学", "苏州大学", "3.0Mbps", "status"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s body should contain %q:\n%s", ct, want, body)
+			}
+		}
+	}
+	if !strings.Contains(bodies["text/html"], "<table") {
+		t.Errorf("html body should contain tables")
+	}
+}
+
+func TestNewReportMessage_SubjectTemplate(t *testing.T) {
+	conf := &emailConf{Address: "robot@fxdata.cn", SMTPServer: "smtp", Subject: "{{.Env"}
+	if err := conf.setDefaults(); err == nil {
+		t.Errorf("illegal subject template should return error")
+	}
+}
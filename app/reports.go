@@ -0,0 +1,215 @@
+package app
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+const diskTypeReport = "disk-type"
+
+func init() {
+	registerReport(&reportKind{
+		name:        diskTypeReport,
+		title:       "cds 磁盘情况报告",
+		description: "device type and disk capacity of cds per label, sent by `fxoss cds-report`",
+		fetchCDS:    fetchDiskType,
+		sheets:      func(d *reportData) []*reportSheet { return diskTypeSheets(d.labels) },
+		fileName:    func(now time.Time) string { return strings.TrimSuffix(utils.GenerateExcelName(now), ".xlsx") },
+		summary:     true,
+		compare:     true,
+	})
+	registerReport(&reportKind{
+		name:        "traffic",
+		title:       "cds 流量报告",
+		description: "users and bandwidth per label and of every cds",
+		sheets:      trafficSheets,
+	})
+	registerReport(&reportKind{
+		name:        "license",
+		title:       "cds license 到期报告",
+		description: "license expiry of cds sorted by days left",
+		sheets:      licenseSheets,
+	})
+	registerReport(&reportKind{
+		name:        "version",
+		title:       "cds 版本分布报告",
+		description: "cds count of every version in total and per label",
+		sheets:      versionSheets,
+	})
+	registerReport(&reportKind{
+		name:        "nem",
+		title:       "nem 绑定报告",
+		description: "nem nodes bound to cds of labels and cds without nem node",
+		fetch:       fetchNemNodes,
+		sheets:      nemSheets,
+	})
+}
+
+func fetchDiskType(oss *OSS, r *diskTypeResult) error {
+	r.diskType, r.diskSize, r.diskErr = oss.getDiskType(r.sn)
+	return r.diskErr
+}
+
+func fetchNemNodes(oss *OSS, d *reportData) error {
+	nodes, err := oss.getNemNodes()
+	if err != nil {
+		return err
+	}
+	d.nemNodes = nodes.List
+	return nil
+}
+
+// kbpsToMbps converts kbps to Mbps rounded to one decimal
+func kbpsToMbps(kbps int64) float64 {
+	return math.Round(float64(kbps)/1024*10) / 10
+}
+
+// labelsOf returns sorted label names of every cds and cds of labels deduplicated by sn
+func labelsOf(data map[string][]*diskTypeResult) (map[string][]string, []*cdsInfo) {
+	labels := make(map[string][]string)
+	var cdsList []*cdsInfo
+	for _, name := range sortedLabels(data) {
+		for _, r := range sortedResults(data[name]) {
+			if _, ok := labels[r.sn]; !ok {
+				cdsList = append(cdsList, r.cds)
+			}
+			labels[r.sn] = append(labels[r.sn], name)
+		}
+	}
+	sort.Slice(cdsList, func(i, j int) bool { return cdsList[i].SN < cdsList[j].SN })
+	return labels, cdsList
+}
+
+// trafficSheets makes a summary sheet of labels and a sheet of cds of every label
+func trafficSheets(d *reportData) []*reportSheet {
+	summary := &reportSheet{Name: "summary", Headers: []string{
+		"Label", "Devices", "Online", "Online Users", "Max Online Users", "Service Mbps", "Max Service Mbps", "Cache Mbps", "Max Cache Mbps",
+	}}
+	sheets := []*reportSheet{summary}
+
+	for _, name := range sortedLabels(d.labels) {
+		sheet := &reportSheet{Name: name, label: true, Headers: []string{
+			"Company", "SN", "Status", "Online Users", "Max Online Users", "Service Mbps", "Max Service Mbps", "Cache Mbps", "Max Cache Mbps",
+		}}
+		var online, users, usersMax, service, serviceMax, cache, cacheMax int64
+		for _, r := range sortedResults(d.labels[name]) {
+			c := r.cds
+			if utils.IsOnline(c.Status) {
+				online++
+			}
+			users += c.OnlineUser
+			usersMax += c.OnlineUserMax
+			service += c.ServiceKbps
+			serviceMax += c.ServiceKbpsMax
+			cache += c.CacheKbps
+			cacheMax += c.CacheKbpsMax
+			sheet.Rows = append(sheet.Rows, []interface{}{
+				c.Company, c.SN, c.Status, c.OnlineUser, c.OnlineUserMax, kbpsToMbps(c.ServiceKbps), kbpsToMbps(c.ServiceKbpsMax), kbpsToMbps(c.CacheKbps), kbpsToMbps(c.CacheKbpsMax),
+			})
+		}
+		summary.Rows = append(summary.Rows, []interface{}{
+			name, int64(len(d.labels[name])), online, users, usersMax, kbpsToMbps(service), kbpsToMbps(serviceMax), kbpsToMbps(cache), kbpsToMbps(cacheMax),
+		})
+		sheets = append(sheets, sheet)
+	}
+	return sheets
+}
+
+// licenseSheets makes a sheet of cds sorted by days left, cds whose license can not be parsed are the last
+func licenseSheets(d *reportData) []*reportSheet {
+	labels, cdsList := labelsOf(d.labels)
+	type item struct {
+		cds  *cdsInfo
+		days int64
+		ok   bool
+	}
+	var items []item
+	for _, c := range cdsList {
+		t, err := utils.ParseTime(c.LicenseEndAt, d.location)
+		items = append(items, item{c, daysLeft(t, d.now), err == nil})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].ok != items[j].ok {
+			return items[i].ok
+		}
+		return items[i].ok && items[i].days < items[j].days
+	})
+
+	sheet := &reportSheet{Name: "license", Headers: []string{"Company", "SN", "Labels", "Status", "License Start", "License End", "Days Left"}}
+	for _, it := range items {
+		var days interface{} = "unknown"
+		if it.ok {
+			days = it.days
+		}
+		c := it.cds
+		sheet.Rows = append(sheet.Rows, []interface{}{c.Company, c.SN, strings.Join(labels[c.SN], ","), c.Status, c.LicenseStartAt, c.LicenseEndAt, days})
+	}
+	return []*reportSheet{sheet}
+}
+
+// versionSheets makes sheets of version counts of all cds and of every label
+func versionSheets(d *reportData) []*reportSheet {
+	_, cdsList := labelsOf(d.labels)
+	counts := make(map[string]int64)
+	for _, c := range cdsList {
+		counts[c.Version]++
+	}
+	total := &reportSheet{Name: "versions", Headers: []string{"Version", "Devices", "Percent"}}
+	for _, row := range utils.CountRows(counts) {
+		n := counts[row[0]]
+		total.Rows = append(total.Rows, []interface{}{row[0], n, math.Round(utils.Ratio(n, int64(len(cdsList)))*1000) / 10})
+	}
+
+	byLabel := &reportSheet{Name: "by label", Headers: []string{"Label", "Version", "Devices"}}
+	for _, name := range sortedLabels(d.labels) {
+		counts := make(map[string]int64)
+		for _, r := range d.labels[name] {
+			counts[r.cds.Version]++
+		}
+		for _, row := range utils.CountRows(counts) {
+			byLabel.Rows = append(byLabel.Rows, []interface{}{name, row[0], counts[row[0]]})
+		}
+	}
+	return []*reportSheet{total, byLabel}
+}
+
+// nemSheets makes a sheet of nem nodes bound to cds of labels and a sheet of cds without nem node
+func nemSheets(d *reportData) []*reportSheet {
+	labels, cdsList := labelsOf(d.labels)
+	bySN := make(map[string]*cdsInfo)
+	for _, c := range cdsList {
+		bySN[c.SN] = c
+	}
+
+	nodes := make([]*nemNode, 0, len(d.nemNodes))
+	bound := make(map[string]bool)
+	for _, n := range d.nemNodes {
+		if _, ok := bySN[n.CdsSN]; ok {
+			nodes = append(nodes, n)
+			bound[n.CdsSN] = true
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].CdsSN != nodes[j].CdsSN {
+			return nodes[i].CdsSN < nodes[j].CdsSN
+		}
+		return nodes[i].SN < nodes[j].SN
+	})
+
+	binding := &reportSheet{Name: "nem", Headers: []string{"CDS SN", "Company", "Labels", "HID", "Customer", "Node Name", "Node SN"}}
+	for _, n := range nodes {
+		c := bySN[n.CdsSN]
+		binding.Rows = append(binding.Rows, []interface{}{c.SN, c.Company, strings.Join(labels[c.SN], ","), n.Hid, n.CustomerName, n.Name, n.SN})
+	}
+	unbound := &reportSheet{Name: "without nem", Headers: []string{"CDS SN", "Company", "Labels", "Status"}}
+	for _, c := range cdsList {
+		if !bound[c.SN] {
+			unbound.Rows = append(unbound.Rows, []interface{}{c.SN, c.Company, strings.Join(labels[c.SN], ","), c.Status})
+		}
+	}
+	return []*reportSheet{binding, unbound}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sheetText(sheets []*reportSheet) string {
+	var text string
+	for _, s := range sheets {
+		text += s.Name + ":"
+		for _, row := range s.Rows {
+			text += fmt.Sprint(row)
+		}
+		text += "\n"
+	}
+	return text
+}
+
+func TestReportKinds(t *testing.T) {
+	d := &reportData{
+		now:      time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		labels:   reportTestData(),
+		location: time.FixedZone("CST", 8*3600),
+		nemNodes: []*nemNode{
+			{Name: "nem-1", SN: "NEM1", Hid: "h1", CdsSN: "CAS0530000102", CustomerName: "南农"},
+			{Name: "nem-x", SN: "NEMX", CdsSN: "CAS0000000000"},
+		},
+	}
+	testCases := []struct {
+		kind, want string
+	}{
+		{"traffic", "summary:[南京 2 1 80 100 1 3 0 0][江苏 2 2 85 105 1.5 2.5 0 0]\n" +
+			"南京:[南京农业大学 CAS0530000102 healthy 80 100 1 2 0 0][南京航空航天大学 CAS0530000231 offline 0 0 0 1 0 0]\n" +
+			"江苏:[南京农业大学 CAS0530000102 healthy 80 100 1 2 0 0][苏州大学 CAS0530000300 warn: icache offline 5 5 0.5 0.5 0 0]\n"},
+		{"license", "license:[南京航空航天大学 CAS0530000231 南京 offline  2026-10-01 00:00:00 -19]" +
+			"[南京农业大学 CAS0530000102 南京,江苏 healthy  2026-11-01 00:00:00 12][苏州大学 CAS0530000300 江苏 warn: icache offline   unknown]\n"},
+		{"version", "versions:[11.3.402 2 66.7][11.2.100 1 33.3]\nby label:[南京 11.3.402 2][江苏 11.2.100 1][江苏 11.3.402 1]\n"},
+		{"nem", "nem:[CAS0530000102 南京农业大学 南京,江苏 h1 南农 nem-1 NEM1]\n" +
+			"without nem:[CAS0530000231 南京航空航天大学 南京 offline][CAS0530000300 苏州大学 江苏 warn: icache offline]\n"},
+	}
+	for _, c := range testCases {
+		if got := sheetText(reportKinds[c.kind].sheets(d)); got != c.want {
+			t.Errorf("%s sheets got\n%s\nwant\n%s", c.kind, got, c.want)
+		}
+	}
+	if len(reportKinds) != 5 || !reportKinds[diskTypeReport].summary {
+		t.Errorf("got %d report kinds", len(reportKinds))
+	}
+}
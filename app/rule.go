@@ -0,0 +1,349 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// alertOperators are checked in order, two-character operators go first
+	alertOperators  = []string{"!=", ">=", "<=", "==", ">", "<", "="}
+	alertSeverities = map[string]bool{"critical": true, "warning": true, "info": true}
+	forPattern      = regexp.MustCompile(`\s+for\s+(\S+)\s*$`)
+
+	// alertFields are fields can be used in rules, fields of nodes and disks start with node_ and disk_
+	alertFields = map[string]bool{
+		"status": true, "version": true, "company": true, "license_expires_in": true, "last_seen": true,
+		"online_user": true, "online_user_max": true, "hit_user": true, "hit_user_max": true,
+		"service_kbps": true, "service_kbps_max": true, "cache_kbps": true, "cache_kbps_max": true,
+		"monitor_kbps": true, "monitor_kbps_max": true,
+		"node_status": true, "node_type": true, "node_hit_user": true, "node_hit_user_max": true,
+		"node_service_kbps": true, "node_service_kbps_max": true, "node_cache_kbps": true, "node_cache_kbps_max": true,
+		"disk_name": true, "disk_status": true, "disk_util": true, "disk_await": true, "disk_usage": true,
+	}
+	// statusFields compared with online are true for every status but offline
+	statusFields = map[string]bool{"status": true, "node_status": true}
+	// durationFields are shown as durations, their values are seconds
+	durationFields = map[string]bool{"license_expires_in": true, "last_seen": true}
+)
+
+// alertRules is the yaml file of alert rules
+type alertRules struct {
+	Rules []*alertRule `yaml:"rules"`
+}
+
+// alertRule fires an alert for every cds, node or disk in scope matching expr for the duration of For
+type alertRule struct {
+	Name     string     `yaml:"name"`
+	Expr     string     `yaml:"expr"`
+	For      string     `yaml:"for"`
+	Severity string     `yaml:"severity"`
+	Repeat   string     `yaml:"repeat"` // a firing alert is reported again after it
+	Scope    alertScope `yaml:"scope"`
+
+	cond        *condition
+	forDuration time.Duration
+	repeat      time.Duration
+}
+
+// alertScope limits cds of a rule, every non-empty list must contain the cds
+type alertScope struct {
+	Labels    []string `yaml:"labels"`
+	Companies []string `yaml:"companies"`
+	SN        []string `yaml:"sn"`
+}
+
+// condition is a parsed rule expression like `service_kbps > 0.9*service_kbps_max`
+type condition struct {
+	field, op string
+	literal   string
+	number    float64
+	isNumber  bool
+	factor    float64
+	ref       string // field on the right side
+}
+
+// alertValues are field values of a cds, node or disk, values are float64 or string
+type alertValues map[string]interface{}
+
+// setDefaults parses expr and durations of rule and validates it
+func (r *alertRule) setDefaults() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule %q: name is required", r.Expr)
+	}
+	expr := r.Expr
+	if m := forPattern.FindStringSubmatch(expr); m != nil {
+		if r.For != "" {
+			return fmt.Errorf("rule %q: duplicated for", r.Name)
+		}
+		r.For = m[1]
+		expr = expr[:len(expr)-len(m[0])]
+	}
+
+	cond, err := parseCondition(expr)
+	if err != nil {
+		return fmt.Errorf("rule %q: %v", r.Name, err)
+	}
+	r.cond = cond
+
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	r.Severity = strings.ToLower(r.Severity)
+	if !alertSeverities[r.Severity] {
+		return fmt.Errorf("rule %q: illegal severity %q", r.Name, r.Severity)
+	}
+
+	for _, item := range []struct {
+		value string
+		d     *time.Duration
+	}{{r.For, &r.forDuration}, {r.Repeat, &r.repeat}} {
+		if item.value == "" {
+			continue
+		}
+		if *item.d, err = utils.ParseDuration(item.value); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// kind returns kind of objects the rule is evaluated on: cds, node or disk
+func (r *alertRule) kind() string {
+	return fieldKind(r.cond.field)
+}
+
+// inScope checks if cds is in scope of rule, members maps label name to sn of its cds
+func (r *alertRule) inScope(cds *cdsInfo, members map[string]map[string]bool) bool {
+	s := r.Scope
+	if len(s.SN) > 0 && !containsString(s.SN, cds.SN) {
+		return false
+	}
+	if len(s.Companies) > 0 && !containsString(s.Companies, cds.Company) {
+		return false
+	}
+	if len(s.Labels) == 0 {
+		return true
+	}
+	for _, name := range s.Labels {
+		if members[name][cds.SN] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCondition parses `<field> <op> <value>`, value is a string, a number, a duration like 14d,
+// a field or a number multiplied by a field. Words of field are joined by underscore,
+// so `license expires in < 14d` is the same as `license_expires_in < 14d`.
+func parseCondition(expr string) (*condition, error) {
+	index, op := -1, ""
+	for i := 0; i < len(expr) && index < 0; i++ {
+		for _, o := range alertOperators {
+			if strings.HasPrefix(expr[i:], o) {
+				index, op = i, o
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("operator is not found in %q", expr)
+	}
+	if op == "=" {
+		op = "=="
+	}
+
+	c := &condition{field: fieldName(expr[:index]), op: op, factor: 1}
+	if !alertFields[c.field] {
+		return nil, fmt.Errorf("unknown field %q", c.field)
+	}
+
+	value := strings.TrimSpace(expr[index+len(op):])
+	if value == "" {
+		return nil, fmt.Errorf("value is missing in %q", expr)
+	}
+
+	if parts := strings.Split(value, "*"); len(parts) == 2 {
+		a, b := strings.TrimSpace(parts[0]), fieldName(parts[1])
+		if _, err := strconv.ParseFloat(a, 64); err != nil {
+			a, b = strings.TrimSpace(parts[1]), fieldName(parts[0])
+		}
+		factor, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			return nil, fmt.Errorf("illegal value %q", value)
+		}
+		c.factor, c.ref = factor, b
+	} else if alertFields[fieldName(value)] {
+		c.ref = fieldName(value)
+	} else if n, err := strconv.ParseFloat(value, 64); err == nil {
+		c.number, c.isNumber = n, true
+	} else if d, err := utils.ParseDuration(value); err == nil {
+		c.number, c.isNumber = d.Seconds(), true
+	}
+	c.literal = strings.Trim(value, `"'`)
+
+	if c.ref != "" {
+		if !alertFields[c.ref] || fieldKind(c.ref) != fieldKind(c.field) {
+			return nil, fmt.Errorf("illegal field %q in %q", c.ref, expr)
+		}
+	}
+	if c.ref == "" && !c.isNumber && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("%q requires a number", expr)
+	}
+	return c, nil
+}
+
+// match evaluates the condition on values, it returns false if a field is missing
+func (c *condition) match(values alertValues) bool {
+	lhs, ok := values[c.field]
+	if !ok {
+		return false
+	}
+
+	if s, ok := lhs.(string); ok {
+		equal := strings.EqualFold(s, c.literal)
+		if statusFields[c.field] && strings.EqualFold(c.literal, "online") {
+			// warn and healthy are online too
+			equal = utils.IsOnline(s)
+		}
+		switch c.op {
+		case "==":
+			return equal
+		case "!=":
+			return !equal
+		}
+		return false
+	}
+
+	left, ok := lhs.(float64)
+	if !ok {
+		return false
+	}
+	right := c.number
+	if c.ref != "" {
+		v, ok := values[c.ref].(float64)
+		if !ok {
+			return false
+		}
+		right = c.factor * v
+	} else if !c.isNumber {
+		return false
+	}
+
+	switch c.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	}
+	return false
+}
+
+// formatValue formats value of the condition field
+func (c *condition) formatValue(values alertValues) string {
+	switch v := values[c.field].(type) {
+	case string:
+		return v
+	case float64:
+		if durationFields[c.field] {
+			return strings.TrimSuffix(utils.FormatAgo(time.Duration(v)*time.Second), " ago")
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "-"
+}
+
+// cdsValues returns alert field values of cds
+func cdsValues(cds *cdsInfo, now time.Time, l *time.Location) alertValues {
+	values := alertValues{
+		"status":           utils.StatusKind(cds.Status),
+		"version":          cds.Version,
+		"company":          cds.Company,
+		"online_user":      float64(cds.OnlineUser),
+		"online_user_max":  float64(cds.OnlineUserMax),
+		"hit_user":         float64(cds.HitUser),
+		"hit_user_max":     float64(cds.HitUserMax),
+		"service_kbps":     float64(cds.ServiceKbps),
+		"service_kbps_max": float64(cds.ServiceKbpsMax),
+		"cache_kbps":       float64(cds.CacheKbps),
+		"cache_kbps_max":   float64(cds.CacheKbpsMax),
+		"monitor_kbps":     float64(cds.MonitorKbps),
+		"monitor_kbps_max": float64(cds.MonitorKbpsMax),
+	}
+	if t, err := utils.ParseTime(cds.LicenseEndAt, l); err == nil {
+		values["license_expires_in"] = t.Sub(now).Seconds()
+	}
+	if t, err := utils.ParseTime(cds.UpdatedAt, l); err == nil {
+		values["last_seen"] = now.Sub(t).Seconds()
+	}
+	return values
+}
+
+// nodeValues returns alert field values of node
+func nodeValues(n *node) alertValues {
+	return alertValues{
+		"node_status":           utils.StatusKind(n.Status),
+		"node_type":             n.Type,
+		"node_hit_user":         float64(n.HitUser),
+		"node_hit_user_max":     float64(n.HitUserMax),
+		"node_service_kbps":     float64(n.ServiceKbps),
+		"node_service_kbps_max": float64(n.ServiceKbpsMax),
+		"node_cache_kbps":       float64(n.CacheKbps),
+		"node_cache_kbps_max":   float64(n.CacheKbpsMax),
+	}
+}
+
+// diskValues returns alert field values of disk, values can't be parsed are missing
+func diskValues(d *disk) alertValues {
+	values := alertValues{
+		"disk_name":   d.Name,
+		"disk_status": float64(d.Status),
+	}
+	if util, err := utils.ParseNumber(d.Util); err == nil {
+		values["disk_util"] = util
+	}
+	if await, err := utils.ParseNumber(d.Await); err == nil {
+		values["disk_await"] = await
+	}
+	if usage, ok := diskUsage(d); ok {
+		values["disk_usage"] = usage
+	}
+	return values
+}
+
+// fieldName lowercases s and joins its words by underscore
+func fieldName(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), "_")
+}
+
+func fieldKind(field string) string {
+	switch {
+	case strings.HasPrefix(field, "node_"):
+		return "node"
+	case strings.HasPrefix(field, "disk_"):
+		return "disk"
+	}
+	return "cds"
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
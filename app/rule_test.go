@@ -0,0 +1,119 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCondition(t *testing.T) {
+	testCases := []struct {
+		expr   string
+		values alertValues
+		want   bool
+	}{
+		{"status != online", alertValues{"status": "offline"}, true},
+		{"status != online", alertValues{"status": "Online"}, false},
+		{"status != online", alertValues{"status": "warn"}, false},
+		{"status == healthy", alertValues{"status": "warn"}, false},
+		{"service_kbps > 0.9*service_kbps_max", alertValues{"service_kbps": 95.0, "service_kbps_max": 100.0}, true},
+		{"service_kbps > service_kbps_max * 0.9", alertValues{"service_kbps": 80.0, "service_kbps_max": 100.0}, false},
+		{"license expires in < 14d", alertValues{"license_expires_in": (13 * 24 * time.Hour).Seconds()}, true},
+		{"license expires in < 14d", alertValues{"license_expires_in": (15 * 24 * time.Hour).Seconds()}, false},
+		{"license expires in < 14d", alertValues{}, false},
+		{"disk status != 0", alertValues{"disk_status": 1.0}, true},
+		{"disk_status = 0", alertValues{"disk_status": 0.0}, true},
+		{"node_type == 'icache'", alertValues{"node_type": "icache"}, true},
+	}
+	for _, c := range testCases {
+		cond, err := parseCondition(c.expr)
+		if err != nil {
+			t.Errorf("parseCondition(%q) error %v", c.expr, err)
+			continue
+		}
+		if got := cond.match(c.values); got != c.want {
+			t.Errorf("%q match %v got %v != want %v", c.expr, c.values, got, c.want)
+		}
+	}
+
+	for _, expr := range []string{"status", "unknown > 1", "status > online", "service_kbps > 0.9*disk_util", "status =="} {
+		if _, err := parseCondition(expr); err == nil {
+			t.Errorf("parseCondition(%q) should return error", expr)
+		}
+	}
+}
+
+func TestAlertRule_SetDefaults(t *testing.T) {
+	r := &alertRule{Name: "offline", Expr: "status != online for 5m"}
+	if err := r.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if r.forDuration != 5*time.Minute || r.Severity != "warning" || r.kind() != "cds" || r.cond.literal != "online" {
+		t.Errorf("rule got: %+v, cond: %+v", r, r.cond)
+	}
+
+	r = &alertRule{Name: "disk", Expr: "disk status != 0", Severity: "fatal"}
+	if err := r.setDefaults(); err == nil {
+		t.Errorf("illegal severity should return error")
+	}
+}
+
+func TestAlertRule_InScope(t *testing.T) {
+	cds := &cdsInfo{SN: "CAS1", Company: "a"}
+	members := map[string]map[string]bool{"south": {"CAS1": true}}
+	testCases := []struct {
+		scope alertScope
+		want  bool
+	}{
+		{alertScope{}, true},
+		{alertScope{SN: []string{"CAS2", "CAS1"}}, true},
+		{alertScope{Companies: []string{"b"}}, false},
+		{alertScope{Labels: []string{"north", "south"}, Companies: []string{"a"}}, true},
+		{alertScope{Labels: []string{"north"}}, false},
+	}
+	for _, c := range testCases {
+		r := &alertRule{Scope: c.scope}
+		if got := r.inScope(cds, members); got != c.want {
+			t.Errorf("inScope %+v got %v != want %v", c.scope, got, c.want)
+		}
+	}
+}
+
+func TestUpdateAlerts(t *testing.T) {
+	now := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	rule := &alertRule{Name: "offline", Severity: "critical", forDuration: 5 * time.Minute, repeat: time.Hour}
+	diskRule := &alertRule{Name: "disk", Severity: "warning"}
+	states := make(map[string]*alertState)
+	offline := map[string]*alertMatch{
+		"offline|CAS1":  {rule: rule, target: "CAS1", kind: "cds", cdsSN: "CAS1"},
+		"disk|CAS2/sda": {rule: diskRule, target: "CAS2/sda", kind: "disk", cdsSN: "CAS2"},
+	}
+
+	events := updateAlerts(states, offline, nil, now)
+	if len(events) != 1 || events[0].kind != "firing" || events[0].state.Rule != "disk" {
+		t.Fatalf("first evaluation got events %v", events)
+	}
+	if states["offline|CAS1"].Status != "pending" {
+		t.Errorf("offline should be pending, got %+v", states["offline|CAS1"])
+	}
+
+	// firing after 5m, the disk alert is deduplicated
+	events = updateAlerts(states, offline, nil, now.Add(5*time.Minute))
+	if len(events) != 1 || events[0].kind != "firing" || events[0].state.Rule != "offline" {
+		t.Fatalf("second evaluation got events %v", events)
+	}
+
+	// disks of CAS2 failed to fetch, the disk alert is kept
+	events = updateAlerts(states, nil, map[string]bool{"CAS2": true}, now.Add(10*time.Minute))
+	if len(events) != 1 || events[0].kind != "resolved" || events[0].state.Rule != "offline" {
+		t.Fatalf("third evaluation got events %v", events)
+	}
+	if states["disk|CAS2/sda"].Status != "firing" {
+		t.Errorf("disk alert should be firing, got %+v", states["disk|CAS2/sda"])
+	}
+
+	// a resolved alert fires again as pending
+	updateAlerts(states, offline, nil, now.Add(20*time.Minute))
+	if st := states["offline|CAS1"]; st.Status != "pending" || !st.Since.Equal(now.Add(20*time.Minute)) {
+		t.Errorf("offline should be pending again, got %+v", st)
+	}
+}
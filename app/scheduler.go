@@ -0,0 +1,413 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/super1-chen/fxoss/logger"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	schedulerDir   = "scheduler"
+	jobHistoryJSON = "history.json"
+	jobLogDir      = "logs"
+	jobLogLayout   = "20060102T150405Z"
+	jobTimeLayout  = "2006-01-02 15:04:05"
+	jobLogTail     = 20
+)
+
+// jobRun is a run of a scheduler job
+type jobRun struct {
+	Job         string    `json:"job"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Status      string    `json:"status"` // success, failed, timeout, skipped or canceled
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	Log         string    `json:"log,omitempty"`
+}
+
+// jobHistory keeps the last runs of every job in a json file
+type jobHistory struct {
+	mu       sync.Mutex
+	filename string
+	keep     int
+	runs     map[string][]*jobRun
+}
+
+// scheduler runs jobs of settings as fxoss sub processes
+type scheduler struct {
+	oss     *OSS
+	exe     string
+	history *jobHistory
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// RunScheduler runs jobs of scheduler settings on their cron schedules until it is stopped.
+// A run is skipped if the last run of the job is still running.
+func (oss *OSS) RunScheduler() error {
+	if err := oss.settings.check("scheduler"); err != nil {
+		return err
+	}
+	conf := oss.settings.Scheduler
+	if len(conf.Jobs) == 0 {
+		return fmt.Errorf("no job is found in scheduler of %s", settingsJSON)
+	}
+	history, err := loadJobHistory(conf.History)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find fxoss executable failed %v", err)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	s := &scheduler{oss: oss, exe: exe, history: history, running: make(map[string]bool)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now().In(conf.location)
+	next := make(map[string]time.Time)
+	for _, job := range conf.Jobs {
+		next[job.Name] = job.schedule.Next(now)
+		if last := history.last(job.Name); job.CatchUp && missedRun(job, last, now) {
+			utils.ColorPrintln(fmt.Sprintf("job %s missed a run since %s, catch up", job.Name, last.ScheduledAt.In(conf.location).Format(jobTimeLayout)), utils.Yellow)
+			s.start(ctx, job, now)
+		}
+	}
+	utils.SuccessPrintln(fmt.Sprintf("Scheduler runs %d jobs", len(conf.Jobs)))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		var earliest time.Time
+		for _, t := range next {
+			if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t
+			}
+		}
+		if earliest.IsZero() {
+			s.wg.Wait()
+			return fmt.Errorf("no job will run")
+		}
+
+		timer := time.NewTimer(time.Until(earliest))
+		select {
+		case <-timer.C:
+			now := time.Now().In(conf.location)
+			for _, job := range conf.Jobs {
+				if t := next[job.Name]; !t.IsZero() && !t.After(now) {
+					s.start(ctx, job, t)
+					next[job.Name] = job.schedule.Next(now)
+				}
+			}
+		case sig := <-sigs:
+			timer.Stop()
+			utils.ColorPrintln(fmt.Sprintf("receive signal %s, cancel running jobs and stop scheduler", sig), utils.Yellow)
+			cancel()
+			s.wg.Wait()
+			return nil
+		}
+	}
+}
+
+// ShowSchedulerStatus shows the last run and the next run of every job, it shows runs and the last log of job if job is not empty
+func ShowSchedulerStatus(now time.Time, job string, verbose bool) error {
+	oss := &OSS{logger: logger.Mylogger(verbose)}
+	s, err := oss.loadSettings()
+	if err != nil {
+		return err
+	}
+	if err = s.check("scheduler"); err != nil {
+		return err
+	}
+	conf := s.Scheduler
+	history, err := loadJobHistory(conf.History)
+	if err != nil {
+		return err
+	}
+	if job != "" {
+		return showJobRuns(history.runs[job], job, conf.location)
+	}
+
+	if len(conf.Jobs) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("No job is found in scheduler of %s", settingsJSON), utils.Yellow)
+		return nil
+	}
+	headers := []string{"#", "job", "schedule", "args", "last_run", "last_status", "duration", "next_run", "failures"}
+	var content [][]string
+	for index, j := range conf.Jobs {
+		index++
+		lastRun, lastStatus, duration := "-", "-", "-"
+		if last := history.last(j.Name); last != nil {
+			lastRun = last.ScheduledAt.In(conf.location).Format(jobTimeLayout)
+			lastStatus = jobStatusText(last.Status)
+			duration = runDuration(last)
+		}
+		nextRun := "-"
+		if t := j.schedule.Next(now.In(conf.location)); !t.IsZero() {
+			nextRun = t.Format(jobTimeLayout)
+		}
+		failures := 0
+		for _, run := range history.runs[j.Name] {
+			if run.Status != "success" && run.Status != "skipped" {
+				failures++
+			}
+		}
+		content = append(content, []string{
+			strconv.Itoa(index),
+			j.Name,
+			j.Schedule,
+			strings.Join(j.Args, " "),
+			lastRun,
+			lastStatus,
+			duration,
+			nextRun,
+			fmt.Sprintf("%d/%d", failures, len(history.runs[j.Name])),
+		})
+	}
+	utils.PrintTable(headers, content)
+	return nil
+}
+
+// start runs job in background after a random jitter, it records a skipped run if job is running
+func (s *scheduler) start(ctx context.Context, job *jobConf, scheduledAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[job.Name] {
+		run := &jobRun{Job: job.Name, ScheduledAt: scheduledAt, StartedAt: time.Now(), FinishedAt: time.Now(),
+			Status: "skipped", Error: "the last run is still running"}
+		s.record(run)
+		return
+	}
+	s.running[job.Name] = true
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			s.running[job.Name] = false
+			s.mu.Unlock()
+		}()
+
+		if job.jitter > 0 {
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(job.jitter)))):
+			case <-ctx.Done():
+				return
+			}
+		}
+		s.record(s.run(ctx, job, scheduledAt))
+	}()
+}
+
+// run runs fxoss with args of job and saves its output as the log of the run
+func (s *scheduler) run(ctx context.Context, job *jobConf, scheduledAt time.Time) *jobRun {
+	run := &jobRun{Job: job.Name, ScheduledAt: scheduledAt, StartedAt: time.Now()}
+	defer func() { run.FinishedAt = time.Now() }()
+
+	dir := path.Join(confDir(), schedulerDir, jobLogDir, job.Name)
+	if err := utils.CreateFolder(dir); err != nil {
+		run.Status, run.Error = "failed", err.Error()
+		return run
+	}
+	run.Log = path.Join(dir, run.StartedAt.UTC().Format(jobLogLayout)+".log")
+	f, err := os.Create(run.Log)
+	if err != nil {
+		run.Status, run.Error = "failed", fmt.Sprintf("create log %s failed %v", run.Log, err)
+		return run
+	}
+	defer f.Close()
+
+	jobCtx, cancel := context.WithTimeout(ctx, job.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(jobCtx, s.exe, job.Args...)
+	cmd.Stdout, cmd.Stderr = f, f
+	s.oss.logger.Printf("run job %s: %s %s", job.Name, s.exe, strings.Join(job.Args, " "))
+
+	err = cmd.Run()
+	switch {
+	case err == nil:
+		run.Status = "success"
+	case ctx.Err() != nil:
+		run.Status, run.Error = "canceled", "scheduler is stopped"
+	case jobCtx.Err() == context.DeadlineExceeded:
+		run.Status, run.Error = "timeout", fmt.Sprintf("killed after %s", job.timeout)
+	default:
+		run.Status, run.Error = "failed", err.Error()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		run.ExitCode = exitErr.ExitCode()
+	}
+	return run
+}
+
+// record saves run into history and prints it
+func (s *scheduler) record(run *jobRun) {
+	msg := fmt.Sprintf("%s job %s %s", run.StartedAt.Format(time.RFC3339), run.Job, run.Status)
+	if run.Status != "skipped" {
+		msg += " in " + runDuration(run)
+	}
+	if run.Error != "" {
+		msg += ": " + run.Error
+	}
+	switch run.Status {
+	case "success":
+		utils.SuccessPrintln(msg)
+	case "skipped", "canceled":
+		utils.ColorPrintln(msg, utils.Yellow)
+	default:
+		utils.ErrorPrintln(msg, false)
+	}
+	if err := s.history.add(run); err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
+
+// missedRun checks if job should have run between its last run and now,
+// a job without history has never run so it is not caught up on its first start.
+func missedRun(job *jobConf, last *jobRun, now time.Time) bool {
+	if last == nil {
+		return false
+	}
+	t := job.schedule.Next(last.ScheduledAt.In(now.Location()))
+	return !t.IsZero() && t.Before(now)
+}
+
+func loadJobHistory(keep int) (*jobHistory, error) {
+	h := &jobHistory{
+		filename: path.Join(confDir(), schedulerDir, jobHistoryJSON),
+		keep:     keep,
+		runs:     make(map[string][]*jobRun),
+	}
+	b, err := ioutil.ReadFile(h.filename)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read job history %s failed: %v", h.filename, err)
+	}
+	if err = json.Unmarshal(b, &h.runs); err != nil {
+		return nil, fmt.Errorf("json unmarshal job history %s failed %v", h.filename, err)
+	}
+	return h, nil
+}
+
+// add appends run and saves history, logs of runs out of the kept runs are removed
+func (h *jobHistory) add(run *jobRun) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := append(h.runs[run.Job], run)
+	if len(runs) > h.keep {
+		for _, old := range runs[:len(runs)-h.keep] {
+			if old.Log != "" {
+				os.Remove(old.Log)
+			}
+		}
+		runs = runs[len(runs)-h.keep:]
+	}
+	h.runs[run.Job] = runs
+
+	if err := utils.CreateFolder(path.Dir(h.filename)); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(h.runs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal job history failed %v", err)
+	}
+	if err = ioutil.WriteFile(h.filename+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("write job history %s failed %v", h.filename, err)
+	}
+	if err = os.Rename(h.filename+".tmp", h.filename); err != nil {
+		return fmt.Errorf("write job history %s failed %v", h.filename, err)
+	}
+	return nil
+}
+
+// last returns the last run of job which is not skipped
+func (h *jobHistory) last(job string) *jobRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := h.runs[job]
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Status != "skipped" {
+			return runs[i]
+		}
+	}
+	return nil
+}
+
+func showJobRuns(runs []*jobRun, job string, location *time.Location) error {
+	if len(runs) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("No run of job %q", job), utils.Yellow)
+		return nil
+	}
+
+	headers := []string{"#", "scheduled_at", "started_at", "duration", "status", "exit_code", "error"}
+	var content [][]string
+	for index, run := range runs {
+		index++
+		content = append(content, []string{
+			strconv.Itoa(index),
+			run.ScheduledAt.In(location).Format(jobTimeLayout),
+			run.StartedAt.In(location).Format(jobTimeLayout),
+			runDuration(run),
+			jobStatusText(run.Status),
+			strconv.Itoa(run.ExitCode),
+			run.Error,
+		})
+	}
+	utils.PrintTable(headers, content)
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Log == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(runs[i].Log)
+		if err != nil {
+			return fmt.Errorf("read job log %s failed: %v", runs[i].Log, err)
+		}
+		lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		if len(lines) > jobLogTail {
+			lines = lines[len(lines)-jobLogTail:]
+		}
+		utils.SuccessPrintln(fmt.Sprintf("Last %d lines of %s", len(lines), runs[i].Log))
+		fmt.Println(strings.Join(lines, "\n"))
+		break
+	}
+	return nil
+}
+
+func runDuration(run *jobRun) string {
+	return run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+}
+
+func jobStatusText(status string) string {
+	switch status {
+	case "success":
+		return utils.ColorText(status, utils.Green)
+	case "skipped", "canceled":
+		return utils.ColorText(status, utils.Yellow)
+	}
+	return utils.ColorText(status, utils.Red)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/super1-chen/fxoss/cron"
+)
+
+func TestMissedRun(t *testing.T) {
+	schedule, err := cron.Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &jobConf{Name: "report", schedule: schedule}
+	now := time.Date(2026, 9, 2, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		last *jobRun
+		want bool
+	}{
+		{nil, false},
+		{&jobRun{ScheduledAt: time.Date(2026, 9, 2, 9, 0, 0, 0, time.UTC)}, false},
+		{&jobRun{ScheduledAt: time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)}, true},
+	}
+	for _, c := range testCases {
+		if got := missedRun(job, c.last, now); got != c.want {
+			t.Errorf("missedRun(%+v) got %v != want %v", c.last, got, c.want)
+		}
+	}
+}
+
+func TestJobHistory_Add(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fxoss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(confDirKey, dir)
+	defer os.Unsetenv(confDirKey)
+
+	h, err := loadJobHistory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	for i, status := range []string{"success", "failed", "skipped"} {
+		log := path.Join(dir, status+".log")
+		ioutil.WriteFile(log, []byte(status), 0644)
+		logs = append(logs, log)
+		if err = h.add(&jobRun{Job: "report", Status: status, ExitCode: i, Log: log}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err = loadJobHistory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := h.runs["report"]; len(runs) != 2 || runs[0].Status != "failed" || runs[1].Status != "skipped" {
+		t.Errorf("runs got %+v", runs)
+	}
+	if last := h.last("report"); last == nil || last.Status != "failed" {
+		t.Errorf("last run should skip skipped run, got %+v", last)
+	}
+	if _, err = os.Stat(logs[0]); !os.IsNotExist(err) {
+		t.Errorf("log of removed run should be removed")
+	}
+}
+
+func TestSchedulerConf_JobName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"report":         true,
+		"cds-license.v2": true,
+		"":               false,
+		"..":             false,
+		"../report":      false,
+		"a/b":            false,
+		"日报":             false,
+	} {
+		s := &schedulerConf{Jobs: []*jobConf{{Name: name, Schedule: "@daily", Args: []string{"cds-list"}}}}
+		if err := s.setDefaults(); (err == nil) != valid {
+			t.Errorf("job name %q got err %v, want valid %t", name, err, valid)
+		}
+	}
+}
+
+func TestSchedulerConf_Durations(t *testing.T) {
+	testCases := []struct {
+		timeout, jitter string
+		valid           bool
+	}{
+		{"", "", true},
+		{"2h", "5m", true},
+		{"1h", "0", true},
+		{"0", "", false},
+		{"-1m", "", false},
+		{"1h", "-5m", false},
+		{"1h", "soon", false},
+	}
+	for _, c := range testCases {
+		s := &schedulerConf{Jobs: []*jobConf{{Name: "report", Schedule: "@daily", Args: []string{"cds-list"}, Timeout: c.timeout, Jitter: c.jitter}}}
+		if err := s.setDefaults(); (err == nil) != c.valid {
+			t.Errorf("timeout %q jitter %q got err %v, want valid %t", c.timeout, c.jitter, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// fleetCDS is a cds enriched with labels, ports, disk tier and nem binding
+type fleetCDS struct {
+	*cdsInfo
+	Labels    []string   `json:"labels"`
+	DiskType  int64      `json:"disk_type"` // 0 if disk type is unknown
+	DiskSize  string     `json:"disk_size"` // `unknown` if disk type is unknown
+	DiskError string     `json:"disk_error,omitempty"`
+	NemNodes  []*nemNode `json:"nem_nodes"`
+	Ports     *portInfo  `json:"-"`
+}
+
+// fleetCache is the data served by `fxoss serve`, it is replaced as a whole on refresh
+type fleetCache struct {
+	mu        sync.RWMutex
+	cds       []*fleetCDS
+	bySN      map[string]*fleetCDS
+	labels    []*snapshotLabel
+	nemNodes  []*nemNode
+	refreshed time.Time
+	err       error
+}
+
+// fleetServer serves read-only json api over fleet cache
+type fleetServer struct {
+	cache   *fleetCache
+	apiKeys []string
+	logger  func(format string, v ...interface{})
+}
+
+// Serve serves enriched cds, labels, ports and nem nodes as json api on listen until it is stopped,
+// data are refreshed from api every refresh in background.
+func (oss *OSS) Serve(listen string, refresh time.Duration) error {
+	if refresh <= 0 {
+		return fmt.Errorf("illegal refresh %s", refresh)
+	}
+	// ssh host and port of every cds must not be exposed without auth
+	if len(oss.settings.Serve.APIKeys) == 0 {
+		if !loopbackAddr(listen) {
+			return fmt.Errorf("serve.api_keys of %s is empty, listen on 127.0.0.1 or configure api keys", settingsJSON)
+		}
+		utils.ColorPrintln(fmt.Sprintf("serve.api_keys of %s is empty, api key auth is disabled", settingsJSON), utils.Yellow)
+	}
+
+	cache := new(fleetCache)
+	oss.refreshFleet(cache)
+
+	fs := &fleetServer{cache: cache, apiKeys: oss.settings.Serve.APIKeys, logger: oss.logger.Printf}
+	server := &http.Server{Addr: listen, Handler: fs}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+	utils.SuccessPrintln(fmt.Sprintf("Serve api on %s, refresh every %s", listen, refresh))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			oss.refreshFleet(cache)
+		case err := <-errs:
+			return fmt.Errorf("serve api failed %v", err)
+		case sig := <-sigs:
+			utils.ColorPrintln(fmt.Sprintf("receive signal %s, stop serving", sig), utils.Yellow)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return server.Shutdown(ctx)
+		}
+	}
+}
+
+// refreshFleet fetches and joins cds, labels, ports, disk tiers and nem nodes,
+// the cache keeps the last data if it fails.
+func (oss *OSS) refreshFleet(cache *fleetCache) {
+	now := time.Now().UTC()
+	oss.ensureToken(now)
+
+	snap, err := oss.fetchSnapshot(now)
+	if err != nil {
+		oss.logger.Printf("refresh fleet failed %v", err)
+		cache.mu.Lock()
+		cache.err = err
+		cache.mu.Unlock()
+		return
+	}
+
+	fleet := make([]*fleetCDS, 0, len(snap.CDS))
+	bySN := make(map[string]*fleetCDS)
+	for _, cds := range snap.CDS {
+		f := &fleetCDS{cdsInfo: cds, Labels: []string{}, NemNodes: []*nemNode{}, Ports: snap.Ports[cds.SN]}
+		fleet = append(fleet, f)
+		bySN[cds.SN] = f
+	}
+	for _, l := range snap.Labels {
+		for _, sn := range l.SN {
+			if f, ok := bySN[sn]; ok {
+				f.Labels = append(f.Labels, l.Name)
+			}
+		}
+	}
+	for _, n := range snap.NemNodes {
+		if f, ok := bySN[n.CdsSN]; ok {
+			f.NemNodes = append(f.NemNodes, n)
+		}
+	}
+	oss.fetchDiskTiers(fleet)
+	sort.Slice(fleet, func(i, j int) bool { return fleet[i].SN < fleet[j].SN })
+
+	cache.mu.Lock()
+	cache.cds, cache.bySN, cache.labels, cache.nemNodes = fleet, bySN, snap.Labels, snap.NemNodes
+	cache.refreshed, cache.err = now, nil
+	cache.mu.Unlock()
+	oss.logger.Printf("refresh fleet of %d cds", len(fleet))
+}
+
+// loopbackAddr checks the listen address only accepts local connections
+func loopbackAddr(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// fetchDiskTiers fills disk type and size of cds concurrently, the error is kept if disk type is unknown
+func (oss *OSS) fetchDiskTiers(fleet []*fleetCDS) {
+	wg := &sync.WaitGroup{}
+	in := make(chan *fleetCDS)
+	for i := 0; i < oss.settings.Report.CDSWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range in {
+				diskType, size, err := oss.getDiskType(f.SN)
+				if err != nil {
+					oss.logger.Printf("get disk type of %s failed %v", f.SN, err)
+					f.DiskSize, f.DiskError = "unknown", err.Error()
+					continue
+				}
+				f.DiskType, f.DiskSize = diskType, utils.FormatSize(size)
+			}
+		}()
+	}
+	for _, f := range fleet {
+		in <- f
+	}
+	close(in)
+	wg.Wait()
+}
+
+func (fs *fleetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	fs.logger("%s %s %s", r.RemoteAddr, r.Method, r.URL)
+
+	p := strings.Trim(r.URL.Path, "/")
+	if p == "healthz" {
+		fs.healthz(w)
+		return
+	}
+	if !fs.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+		return
+	}
+
+	fs.cache.mu.RLock()
+	defer fs.cache.mu.RUnlock()
+	if fs.cache.refreshed.IsZero() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "data is not ready"})
+		return
+	}
+
+	parts := strings.Split(p, "/")
+	switch {
+	case p == "cds":
+		fs.listCDS(w, r)
+	case len(parts) == 2 && parts[0] == "cds":
+		if f := fs.cache.bySN[parts[1]]; f != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"cds": f})
+			return
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("cds %s is not found", parts[1])})
+	case len(parts) == 3 && parts[0] == "cds" && parts[2] == "ports":
+		f := fs.cache.bySN[parts[1]]
+		if f == nil || f.Ports == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("ports of cds %s are not found", parts[1])})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ports": f.Ports})
+	case p == "labels":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"labels": fs.cache.labels})
+	case p == "nem/nodes":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"nodes": fs.cache.nemNodes})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// listCDS serves cds filtered by `filter` (substring of sn or company like `fxoss cds-list`) and `label`
+func (fs *fleetServer) listCDS(w http.ResponseWriter, r *http.Request) {
+	filter, label := r.URL.Query().Get("filter"), r.URL.Query().Get("label")
+
+	results := []*fleetCDS{}
+	for _, f := range fs.cache.cds {
+		if len(filterCDS([]*cdsInfo{f.cdsInfo}, filter)) == 0 {
+			continue
+		}
+		if label != "" && !containsString(f.Labels, label) {
+			continue
+		}
+		results = append(results, f)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cds":          results,
+		"count":        len(results),
+		"refreshed_at": fs.cache.refreshed,
+	})
+}
+
+func (fs *fleetServer) healthz(w http.ResponseWriter) {
+	fs.cache.mu.RLock()
+	defer fs.cache.mu.RUnlock()
+
+	ret := map[string]interface{}{"status": "ok", "cds": len(fs.cache.cds), "refreshed_at": fs.cache.refreshed}
+	if fs.cache.err != nil {
+		ret["last_error"] = fs.cache.err.Error()
+	}
+	status := http.StatusOK
+	if fs.cache.refreshed.IsZero() {
+		ret["status"] = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, ret)
+}
+
+// authorized checks api key of header `X-API-Key` or `Authorization: Bearer <key>`
+func (fs *fleetServer) authorized(r *http.Request) bool {
+	if len(fs.apiKeys) == 0 {
+		return true
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return false
+	}
+	for _, k := range fs.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFleetServer(t *testing.T) {
+	a := &fleetCDS{cdsInfo: &cdsInfo{SN: "CAS1", Company: "南京农业大学"}, Labels: []string{"江苏"},
+		DiskType: 1000, Ports: &portInfo{SSHPort: 22}}
+	b := &fleetCDS{cdsInfo: &cdsInfo{SN: "CAS2", Company: "测试"}, Labels: []string{}}
+	cache := &fleetCache{
+		cds:       []*fleetCDS{a, b},
+		bySN:      map[string]*fleetCDS{"CAS1": a, "CAS2": b},
+		labels:    []*snapshotLabel{{ID: 1, Name: "江苏", SN: []string{"CAS1"}}},
+		refreshed: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+	}
+	fs := &fleetServer{cache: cache, apiKeys: []string{"k1"}, logger: t.Logf}
+
+	testCases := []struct {
+		path, key  string
+		wantStatus int
+		wantCount  int
+	}{
+		{"/healthz", "", http.StatusOK, -1},
+		{"/cds", "", http.StatusUnauthorized, -1},
+		{"/cds", "bad", http.StatusUnauthorized, -1},
+		{"/cds", "k1", http.StatusOK, 2},
+		{"/cds?filter=农业", "k1", http.StatusOK, 1},
+		{"/cds?filter=CAS2", "k1", http.StatusOK, 1},
+		{"/cds?label=江苏", "k1", http.StatusOK, 1},
+		{"/cds/CAS1", "k1", http.StatusOK, -1},
+		{"/cds/CAS3", "k1", http.StatusNotFound, -1},
+		{"/cds/CAS1/ports", "k1", http.StatusOK, -1},
+		{"/cds/CAS2/ports", "k1", http.StatusNotFound, -1},
+		{"/labels", "k1", http.StatusOK, -1},
+		{"/nem/nodes", "k1", http.StatusOK, -1},
+		{"/unknown", "k1", http.StatusNotFound, -1},
+	}
+	for _, c := range testCases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.key != "" {
+			req.Header.Set("Authorization", "Bearer "+c.key)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+		if rec.Code != c.wantStatus {
+			t.Errorf("GET %s got status %d != want %d", c.path, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantCount < 0 {
+			continue
+		}
+		ret := struct {
+			Count int `json:"count"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &ret); err != nil || ret.Count != c.wantCount {
+			t.Errorf("GET %s got count %d err %v != want %d", c.path, ret.Count, err, c.wantCount)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/cds/CAS1", nil)
+	req.Header.Set("X-API-Key", "k1")
+	rec := httptest.NewRecorder()
+	fs.ServeHTTP(rec, req)
+	ret := make(map[string]map[string]interface{})
+	if err := json.Unmarshal(rec.Body.Bytes(), &ret); err != nil {
+		t.Fatal(err)
+	}
+	if cds := ret["cds"]; cds["sn"] != "CAS1" || cds["disk_type"] != 1000.0 || cds["labels"].([]interface{})[0] != "江苏" {
+		t.Errorf("GET /cds/CAS1 got %v", cds)
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	for listen, want := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+		"8080":           false,
+	} {
+		if got := loopbackAddr(listen); got != want {
+			t.Errorf("loopbackAddr(%q) got %t != want %t", listen, got, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/super1-chen/fxoss/cron"
+	"github.com/super1-chen/fxoss/notify"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	settingsJSON = "fx_settings.json"
+	// jobNamePattern keeps job names safe as a directory name of job logs
+	jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// defaultDiskTiers maps total disk size of cds to its device type
+	defaultDiskTiers = []*diskTierConf{
+		{Type: 500, MaxSize: "8T"},
+		{Type: 1000, MaxSize: "20T"},
+		{Type: 2000, MaxSize: "40T"},
+		{Type: 3000, MaxSize: "80T"},
+	}
+)
+
+// settings is the optional configuration of fxoss, default values are used for missing items
+type settings struct {
+	DiskTiers []*diskTierConf           `json:"disk_tiers"`
+	History   historyConf               `json:"history"`
+	Notifiers map[string]*notify.Config `json:"notifiers"`
+	Serve     serveConf                 `json:"serve"`
+	Scheduler schedulerConf             `json:"scheduler"`
+	Report    reportConf                `json:"report"`
+	API       apiConf                   `json:"api"`
+	Timezone  string                    `json:"timezone"` // time zone of times returned by oss api, default Asia/Shanghai
+
+	diskTiers []utils.DiskTier
+	location  *time.Location
+	invalid   map[string]error // sections failed to validate keyed by name, they have default values
+}
+
+// historyConf is the configuration of local metrics history
+type historyConf struct {
+	Interval     string `json:"interval"`      // poll interval of `fxoss collect`
+	RawRetention string `json:"raw_retention"` // raw samples are downsampled after it
+	Retention    string `json:"retention"`     // samples are removed after it
+	Resolution   string `json:"resolution"`    // bucket size of downsampled samples
+
+	interval, rawRetention, retention, resolution time.Duration
+}
+
+// serveConf is the configuration of `fxoss serve`
+type serveConf struct {
+	APIKeys []string `json:"api_keys"` // requests need one of the keys, auth is disabled if it is empty
+}
+
+// schedulerConf is the configuration of `fxoss scheduler`
+type schedulerConf struct {
+	Timezone string     `json:"timezone"` // time zone of schedules, default Asia/Shanghai
+	History  int        `json:"history"`  // runs kept for every job, default 50
+	Jobs     []*jobConf `json:"jobs"`
+
+	location *time.Location
+}
+
+// jobConf is a job of scheduler, it runs fxoss with args
+type jobConf struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"` // cron expression
+	Args     []string `json:"args"`
+	Timeout  string   `json:"timeout"`  // the job is killed after it, default 1h
+	Jitter   string   `json:"jitter"`   // random delay before the job runs
+	CatchUp  bool     `json:"catch_up"` // run once at start if a run is missed while scheduler is down
+
+	schedule        *cron.Schedule
+	timeout, jitter time.Duration
+}
+
+// reportConf is the configuration of the report pipeline and archive
+type reportConf struct {
+	LabelWorkers int    `json:"label_workers"` // workers fetching cds of labels, default 5
+	CDSWorkers   int    `json:"cds_workers"`   // workers fetching data of every cds, default 10
+	Retention    string `json:"retention"`     // sent reports are archived for it, default 90d
+
+	retention time.Duration
+}
+
+// apiConf is the configuration of requests to oss api
+type apiConf struct {
+	RateLimit float64 `json:"rate_limit"` // requests per second of all workers, 0 is unlimited
+}
+
+type diskTierConf struct {
+	Type    int64  `json:"type"`
+	MaxSize string `json:"max_size"`
+}
+
+// loadSettings load settings from config dir, default settings is returned if the file doesn't exist.
+// Invalid sections are warned and set to default values, see settings.check.
+func (oss *OSS) loadSettings() (*settings, error) {
+
+	filename := path.Join(confDir(), settingsJSON)
+	s := new(settings)
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		oss.logger.Printf("file %s doesn't exists, use default settings", filename)
+	} else {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("read settings %s failed: %v", filename, err)
+		}
+		if err = json.Unmarshal(b, s); err != nil {
+			return nil, fmt.Errorf("json unmarshal settings %s failed %v", filename, err)
+		}
+	}
+
+	s.setDefaults()
+	var names []string
+	for name := range s.invalid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oss.logger.Printf("invalid %s of settings %s: %v", name, filename, s.invalid[name])
+		utils.ColorPrintln(fmt.Sprintf("配置%s的%s无效, 使用默认值: %v", filename, name, s.invalid[name]), utils.Yellow)
+	}
+	return s, nil
+}
+
+// setDefaults fills missing items with default values and validates settings. A section failed to
+// validate is set to its default values and kept in invalid, it fails only commands using it.
+func (s *settings) setDefaults() {
+	s.invalid = make(map[string]error)
+	sections := []struct {
+		name  string
+		set   func() error
+		reset func()
+	}{
+		{"timezone", s.setLocation, func() { s.Timezone = "" }},
+		{"disk_tiers", s.setDiskTiers, func() { s.DiskTiers = nil }},
+		{"history", s.History.setDefaults, func() { s.History = historyConf{} }},
+		{"scheduler", s.Scheduler.setDefaults, func() { s.Scheduler = schedulerConf{} }},
+		{"report", s.Report.setDefaults, func() { s.Report = reportConf{} }},
+		{"api", s.API.setDefaults, func() { s.API = apiConf{} }},
+	}
+	for _, section := range sections {
+		if err := section.set(); err != nil {
+			s.invalid[section.name] = err
+			section.reset()
+			section.set()
+		}
+	}
+}
+
+// check returns the error of the first invalid section of sections, commands check the sections
+// they use so that an invalid section doesn't fail other commands
+func (s *settings) check(sections ...string) error {
+	for _, name := range sections {
+		if err := s.invalid[name]; err != nil {
+			return fmt.Errorf("invalid settings %s: %s: %v", path.Join(confDir(), settingsJSON), name, err)
+		}
+	}
+	return nil
+}
+
+func (s *settings) setLocation() error {
+	if s.Timezone == "" {
+		s.Timezone = "Asia/Shanghai"
+	}
+	l, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("illegal timezone %q", s.Timezone)
+	}
+	s.location = l
+	return nil
+}
+
+func (s *settings) setDiskTiers() error {
+	if len(s.DiskTiers) == 0 {
+		s.DiskTiers = defaultDiskTiers
+	}
+	s.diskTiers = s.diskTiers[:0]
+	for _, tier := range s.DiskTiers {
+		size, err := utils.ParseSize(tier.MaxSize)
+		if err != nil {
+			return fmt.Errorf("disk tier %d: %v", tier.Type, err)
+		}
+		s.diskTiers = append(s.diskTiers, utils.DiskTier{Type: tier.Type, MaxSize: size})
+	}
+	return nil
+}
+
+func (r *reportConf) setDefaults() error {
+	if r.LabelWorkers <= 0 {
+		r.LabelWorkers = 5
+	}
+	if r.CDSWorkers <= 0 {
+		r.CDSWorkers = 10
+	}
+	if r.Retention == "" {
+		r.Retention = "90d"
+	}
+	retention, err := utils.ParseDuration(r.Retention)
+	if err != nil || retention <= 0 {
+		return fmt.Errorf("illegal retention %q", r.Retention)
+	}
+	r.retention = retention
+	return nil
+}
+
+func (a *apiConf) setDefaults() error {
+	if a.RateLimit < 0 {
+		return fmt.Errorf("illegal rate limit %v", a.RateLimit)
+	}
+	return nil
+}
+
+func (h *historyConf) setDefaults() error {
+	items := []struct {
+		value        *string
+		defaultValue string
+		d            *time.Duration
+	}{
+		{&h.Interval, "1m", &h.interval},
+		{&h.RawRetention, "45d", &h.rawRetention},
+		{&h.Retention, "400d", &h.retention},
+		{&h.Resolution, "1h", &h.resolution},
+	}
+	for _, item := range items {
+		if *item.value == "" {
+			*item.value = item.defaultValue
+		}
+		d, err := utils.ParseDuration(*item.value)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("illegal duration %q", *item.value)
+		}
+		*item.d = d
+	}
+	return nil
+}
+
+func (s *schedulerConf) setDefaults() error {
+	if s.Timezone == "" {
+		s.Timezone = "Asia/Shanghai"
+	}
+	l, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("illegal timezone %q", s.Timezone)
+	}
+	s.location = l
+	if s.History <= 0 {
+		s.History = 50
+	}
+
+	names := make(map[string]bool)
+	for _, job := range s.Jobs {
+		if job.Name == "" || len(job.Args) == 0 {
+			return fmt.Errorf("name and args of job are required")
+		}
+		if !jobNamePattern.MatchString(job.Name) {
+			return fmt.Errorf("illegal job name %q, only letters, digits, '.', '_' and '-' are allowed", job.Name)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicated job %q", job.Name)
+		}
+		names[job.Name] = true
+
+		if job.schedule, err = cron.Parse(job.Schedule); err != nil {
+			return fmt.Errorf("job %q: %v", job.Name, err)
+		}
+		if job.Timeout == "" {
+			job.Timeout = "1h"
+		}
+		if job.timeout, err = utils.ParseDuration(job.Timeout); err != nil {
+			return fmt.Errorf("job %q: %v", job.Name, err)
+		}
+		if job.timeout <= 0 {
+			return fmt.Errorf("job %q: illegal timeout %q", job.Name, job.Timeout)
+		}
+		if job.Jitter != "" {
+			if job.jitter, err = utils.ParseDuration(job.Jitter); err != nil {
+				return fmt.Errorf("job %q: %v", job.Name, err)
+			}
+			if job.jitter < 0 {
+				return fmt.Errorf("job %q: illegal jitter %q", job.Name, job.Jitter)
+			}
+		}
+	}
+	return nil
+}
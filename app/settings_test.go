@@ -0,0 +1,36 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestSettings_SetDefaults(t *testing.T) {
+	s := &settings{
+		Timezone:  "Mars/Olympus",
+		Scheduler: schedulerConf{Jobs: []*jobConf{{Name: "../report", Schedule: "@daily", Args: []string{"cds-list"}}}},
+		Report:    reportConf{CDSWorkers: 20},
+		History:   historyConf{Interval: "5m"},
+	}
+	s.setDefaults()
+
+	// invalid sections are set to default values
+	if s.location == nil || s.location.String() != "Asia/Shanghai" {
+		t.Errorf("timezone got %v", s.location)
+	}
+	if len(s.Scheduler.Jobs) != 0 || s.Scheduler.location == nil {
+		t.Errorf("scheduler got %+v", s.Scheduler)
+	}
+	// and fail only commands using them
+	if err := s.check("timezone"); err == nil {
+		t.Errorf("invalid timezone should fail")
+	}
+	if err := s.check("history", "scheduler"); err == nil {
+		t.Errorf("invalid scheduler should fail")
+	}
+	if err := s.check("history", "report", "disk_tiers", "api"); err != nil {
+		t.Errorf("valid sections got %v", err)
+	}
+	if s.Report.CDSWorkers != 20 || s.Report.LabelWorkers != 5 || s.History.interval.Minutes() != 5 || len(s.diskTiers) != 4 {
+		t.Errorf("valid sections got %+v %+v %v", s.Report, s.History, s.diskTiers)
+	}
+}
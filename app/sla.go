@@ -0,0 +1,286 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/super1-chen/fxoss/history"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var slaHeaders = []string{"availability", "outages", "downtime", "longest", "mttr", "polling_gaps", "gap_time", "source"}
+
+// span is a time range [start, end)
+type span struct {
+	start, end time.Time
+}
+
+// ShowSLA shows availability, outages and MTTR of cds and nodes of the month (formatted as 2006-01,
+// default last month) from local history. Gaps of polling are reported separately and not counted as downtime.
+func (oss *OSS) ShowSLA(now time.Time, month string) error {
+	if month == "" {
+		month = lastMonth(now, oss.settings.location)
+	}
+	start, end, err := monthRange(month, oss.settings.location)
+	if err != nil {
+		return err
+	}
+	if now.Before(start) {
+		return fmt.Errorf("month %s has not started", month)
+	}
+	if now.Before(end) {
+		end = now
+	}
+
+	store, err := oss.historyStore()
+	if err != nil {
+		return err
+	}
+	samples, err := store.Query(start, end, nil)
+	if err != nil {
+		return err
+	}
+	transitions, err := store.Transitions(start, end, nil)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 && len(transitions) == 0 {
+		utils.ColorPrintln(fmt.Sprintf("History of %s is empty, run `fxoss collect` first", month), utils.Yellow)
+		return nil
+	}
+
+	companies := make(map[string]string)
+	if data, err := oss.getCDSList(); err == nil {
+		for _, cds := range data.CDS {
+			companies[cds.SN] = cds.Company
+		}
+	}
+
+	results := slaResults(samples, transitions, start, end, oss.settings.History.interval)
+
+	utils.SuccessPrintln(fmt.Sprintf("%s SLA from %s to %s", month, start.Format(time.RFC3339), end.Format(time.RFC3339)))
+	var cdsContent, nodeContent [][]string
+	for _, ret := range results {
+		if ret.kind == "cds" {
+			row := []string{strconv.Itoa(len(cdsContent) + 1), companies[ret.sn], ret.sn}
+			cdsContent = append(cdsContent, append(row, slaRow(ret)...))
+		} else {
+			row := []string{strconv.Itoa(len(nodeContent) + 1), ret.cdsSN, ret.sn, ret.kind}
+			nodeContent = append(nodeContent, append(row, slaRow(ret)...))
+		}
+	}
+	if len(cdsContent) > 0 {
+		utils.PrintTable(append([]string{"#", "company", "sn"}, slaHeaders...), cdsContent)
+	}
+	if len(nodeContent) > 0 {
+		utils.SuccessPrintln("Nodes SLA")
+		utils.PrintTable(append([]string{"#", "cds_sn", "sn", "type"}, slaHeaders...), nodeContent)
+	}
+	return nil
+}
+
+// slaResults computes SLA of every cds and node sorted by availability. Outages are taken from
+// status transitions, or from poll samples when there is no transition of the cds or node.
+// Samples are spaced by their own poll interval, interval is used for samples without it.
+func slaResults(samples []*history.Sample, transitions []*history.Transition, start, end time.Time, interval time.Duration) []*slaResult {
+	sampleMap := make(map[sampleKey][]*history.Sample)
+	transitionMap := make(map[sampleKey][]*history.Transition)
+	cdsSNs := make(map[sampleKey]string)
+	for _, s := range samples {
+		key := sampleKey{s.SN, s.Kind}
+		sampleMap[key] = append(sampleMap[key], s)
+		cdsSNs[key] = s.CDSSN
+	}
+	for _, t := range transitions {
+		key := sampleKey{t.SN, t.Kind}
+		transitionMap[key] = append(transitionMap[key], t)
+		cdsSNs[key] = t.CDSSN
+	}
+
+	var results []*slaResult
+	for key, cdsSN := range cdsSNs {
+		ss := sampleMap[key]
+		sort.SliceStable(ss, func(i, j int) bool { return ss[i].Time.Before(ss[j].Time) })
+
+		ret := &slaResult{sn: key.sn, kind: key.kind, cdsSN: cdsSN}
+		gaps := pollingGaps(ss, start, end, interval)
+		for _, g := range gaps {
+			ret.gap += g.end.Sub(g.start)
+		}
+		ret.gaps = len(gaps)
+		ret.observed = end.Sub(start) - ret.gap
+
+		if ts := transitionMap[key]; len(ts) > 0 {
+			ret.source = "transitions"
+			ret.outages = transitionOutages(ss, ts, gaps, start, end)
+		} else {
+			ret.source = "samples"
+			ret.outages = sampleOutages(ss, interval)
+		}
+		for _, o := range ret.outages {
+			ret.downtime += o
+		}
+		results = append(results, ret)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		ai, aj := availability(results[i]), availability(results[j])
+		if ai != aj {
+			return ai < aj
+		}
+		if results[i].sn != results[j].sn {
+			return results[i].sn < results[j].sn
+		}
+		return results[i].kind < results[j].kind
+	})
+	return results
+}
+
+// pollingGaps returns ranges in [start, end) not covered by samples,
+// a sample covers its time plus count times its interval.
+func pollingGaps(samples []*history.Sample, start, end time.Time, interval time.Duration) []span {
+	var gaps []span
+	cursor := start
+	for _, s := range samples {
+		d := sampleInterval(s, interval)
+		if s.Time.Sub(cursor) > d {
+			gaps = append(gaps, span{cursor, s.Time})
+		}
+		if covered := s.Time.Add(time.Duration(sampleCount(s)) * d); covered.After(cursor) {
+			cursor = covered
+		}
+	}
+	if len(samples) > 0 {
+		interval = sampleInterval(samples[len(samples)-1], interval)
+	}
+	if end.Sub(cursor) > interval {
+		gaps = append(gaps, span{cursor, end})
+	}
+	return gaps
+}
+
+// transitionOutages returns length of offline ranges built from transitions, time in gaps is excluded
+func transitionOutages(samples []*history.Sample, transitions []*history.Transition, gaps []span, start, end time.Time) []time.Duration {
+	online := utils.IsOnline(transitions[0].From)
+	if len(samples) > 0 && samples[0].Time.Before(transitions[0].Time) {
+		online = utils.IsOnline(samples[0].Status)
+	}
+
+	var offline []span
+	outageStart := start
+	for _, t := range transitions {
+		to := utils.IsOnline(t.To)
+		if online && !to {
+			outageStart = t.Time
+		}
+		if !online && to {
+			offline = append(offline, span{outageStart, t.Time})
+		}
+		online = to
+	}
+	if !online {
+		offline = append(offline, span{outageStart, end})
+	}
+
+	var outages []time.Duration
+	for _, o := range offline {
+		d := o.end.Sub(o.start)
+		for _, g := range gaps {
+			d -= overlap(o, g)
+		}
+		if d > 0 {
+			outages = append(outages, d)
+		}
+	}
+	return outages
+}
+
+// sampleOutages returns length of outages built from offline samples, an outage ends at an online sample or a gap
+func sampleOutages(samples []*history.Sample, interval time.Duration) []time.Duration {
+	var outages []time.Duration
+	var current time.Duration
+	var prevEnd time.Time
+
+	for i, s := range samples {
+		d := sampleInterval(s, interval)
+		if i > 0 && s.Time.Sub(prevEnd) > d && current > 0 {
+			outages, current = append(outages, current), 0
+		}
+		count := sampleCount(s)
+		if offline := count - s.Online; offline > 0 {
+			current += time.Duration(offline) * d
+		}
+		if s.Online == count && current > 0 {
+			outages, current = append(outages, current), 0
+		}
+		prevEnd = s.Time.Add(time.Duration(count) * d)
+	}
+	if current > 0 {
+		outages = append(outages, current)
+	}
+	return outages
+}
+
+func overlap(a, b span) time.Duration {
+	start, end := a.start, a.end
+	if b.start.After(start) {
+		start = b.start
+	}
+	if b.end.Before(end) {
+		end = b.end
+	}
+	if end.After(start) {
+		return end.Sub(start)
+	}
+	return 0
+}
+
+func sampleCount(s *history.Sample) int64 {
+	if s.Count == 0 {
+		return 1
+	}
+	return s.Count
+}
+
+// sampleInterval returns poll interval of the sample, interval is returned for samples without it
+func sampleInterval(s *history.Sample, interval time.Duration) time.Duration {
+	if s.Interval > 0 {
+		return s.Interval
+	}
+	return interval
+}
+
+func availability(ret *slaResult) float64 {
+	if ret.observed <= 0 {
+		return 0
+	}
+	a := 1 - float64(ret.downtime)/float64(ret.observed)
+	if a < 0 {
+		return 0
+	}
+	return a
+}
+
+func slaRow(ret *slaResult) []string {
+	var longest, mttr time.Duration
+	for _, o := range ret.outages {
+		if o > longest {
+			longest = o
+		}
+	}
+	if len(ret.outages) > 0 {
+		mttr = ret.downtime / time.Duration(len(ret.outages))
+	}
+	return []string{
+		fmt.Sprintf("%0.3f%%", availability(ret)*100),
+		strconv.Itoa(len(ret.outages)),
+		ret.downtime.Round(time.Second).String(),
+		longest.Round(time.Second).String(),
+		mttr.Round(time.Second).String(),
+		strconv.Itoa(ret.gaps),
+		ret.gap.Round(time.Second).String(),
+		ret.source,
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/super1-chen/fxoss/history"
+)
+
+func TestSLAResults(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(60 * time.Minute)
+	at := func(m int) time.Time { return start.Add(time.Duration(m) * time.Minute) }
+
+	var samples []*history.Sample
+	for i := 0; i < 60; i++ {
+		// CAS1 is offline at 10-14 and 30-31 without transitions
+		status := "online"
+		if (i >= 10 && i < 15) || (i >= 30 && i < 32) {
+			status = "offline"
+		}
+		samples = append(samples, &history.Sample{Time: at(i), SN: "CAS1", CDSSN: "CAS1", Kind: "cds", Status: status, Count: 1, Online: onlineCount(status)})
+
+		// CAS2 has no sample at 40-49
+		if i < 40 || i >= 50 {
+			status = "online"
+			if i >= 20 && i < 25 {
+				status = "offline"
+			}
+			samples = append(samples, &history.Sample{Time: at(i), SN: "CAS2", CDSSN: "CAS2", Kind: "cds", Status: status, Count: 1, Online: onlineCount(status)})
+		}
+	}
+	transitions := []*history.Transition{
+		{Time: at(20), SN: "CAS2", CDSSN: "CAS2", Kind: "cds", From: "online", To: "offline"},
+		{Time: at(25), SN: "CAS2", CDSSN: "CAS2", Kind: "cds", From: "offline", To: "online"},
+	}
+
+	results := slaResults(samples, transitions, start, end, time.Minute)
+	if len(results) != 2 {
+		t.Fatalf("got %d results != want 2", len(results))
+	}
+
+	cas1, cas2 := results[0], results[1]
+	if cas1.sn != "CAS1" || cas1.source != "samples" || len(cas1.outages) != 2 || cas1.downtime != 7*time.Minute || cas1.gaps != 0 {
+		t.Errorf("CAS1 result got: %+v", cas1)
+	}
+	if cas2.sn != "CAS2" || cas2.source != "transitions" || len(cas2.outages) != 1 || cas2.downtime != 5*time.Minute {
+		t.Errorf("CAS2 result got: %+v", cas2)
+	}
+	if cas2.gaps != 1 || cas2.gap != 10*time.Minute || cas2.observed != 50*time.Minute {
+		t.Errorf("CAS2 gaps %d gap %v observed %v", cas2.gaps, cas2.gap, cas2.observed)
+	}
+	if a := availability(cas2); a != 0.9 {
+		t.Errorf("CAS2 availability %v != want 0.9", a)
+	}
+}
+
+func TestTransitionOutages_ExcludeGaps(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	transitions := []*history.Transition{
+		{Time: start.Add(30 * time.Minute), SN: "CAS1", Kind: "cds", From: "online", To: "offline"},
+	}
+	gaps := []span{{start.Add(40 * time.Minute), start.Add(50 * time.Minute)}}
+
+	outages := transitionOutages(nil, transitions, gaps, start, end)
+	if len(outages) != 1 || outages[0] != 20*time.Minute {
+		t.Errorf("got outages %v != want [20m]", outages)
+	}
+}
+
+func TestPollingGaps_SampleInterval(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	var samples []*history.Sample
+	// polled every 5m, the interval of settings was changed to 1m later
+	for i := 0; i < 12; i++ {
+		if i == 6 || i == 7 {
+			continue
+		}
+		samples = append(samples, &history.Sample{Time: start.Add(time.Duration(i) * 5 * time.Minute), Count: 1, Interval: 5 * time.Minute})
+	}
+
+	gaps := pollingGaps(samples, start, start.Add(time.Hour), time.Minute)
+	if len(gaps) != 1 || !gaps[0].start.Equal(start.Add(30*time.Minute)) || !gaps[0].end.Equal(start.Add(40*time.Minute)) {
+		t.Errorf("got gaps %v != want [30m, 40m)", gaps)
+	}
+}
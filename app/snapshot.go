@@ -0,0 +1,400 @@
+package app
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	snapshotDir    = "snapshots"
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json.gz"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// SaveSnapshot saves cds, labels, ports and nem nodes state as a compressed json file
+func (oss *OSS) SaveSnapshot(now time.Time) error {
+	filename, err := oss.saveSnapshot(now)
+	if err != nil {
+		return err
+	}
+	utils.SuccessPrintln("保存快照成功: " + filename)
+	return nil
+}
+
+// ShowSnapshotList shows saved snapshots
+func ShowSnapshotList() error {
+	names, err := snapshotNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		utils.ColorPrintln("Snapshot list is empty", utils.Yellow)
+		return nil
+	}
+
+	var content [][]string
+	for index, name := range names {
+		index++
+		content = append(content, []string{strconv.Itoa(index), name})
+	}
+	utils.PrintTable([]string{"#", "name"}, content)
+	return nil
+}
+
+// ShowSnapshotDiff shows changes from snapshot a to snapshot b,
+// a and b are file paths or names of saved snapshots.
+func ShowSnapshotDiff(a, b string) error {
+	before, err := loadSnapshot(a)
+	if err != nil {
+		return err
+	}
+	after, err := loadSnapshot(b)
+	if err != nil {
+		return err
+	}
+
+	utils.SuccessPrintln(fmt.Sprintf("Changes from %s to %s",
+		before.CreatedAt.Format(time.RFC3339), after.CreatedAt.Format(time.RFC3339)))
+
+	changes := diffSnapshots(before, after)
+	if len(changes) == 0 {
+		utils.ColorPrintln("Nothing changed", utils.Yellow)
+		return nil
+	}
+
+	var content [][]string
+	for index, c := range changes {
+		index++
+		content = append(content, []string{strconv.Itoa(index), c.kind, c.sn, c.before, c.after})
+	}
+	utils.PrintTable([]string{"#", "change", "sn", "before", "after"}, content)
+	return nil
+}
+
+// saveSnapshot fetches current state and saves it, it returns the snapshot file path
+func (oss *OSS) saveSnapshot(now time.Time) (string, error) {
+	snap, err := oss.fetchSnapshot(now)
+	if err != nil {
+		return "", err
+	}
+
+	dir := path.Join(confDir(), snapshotDir)
+	if err = utils.CreateFolder(dir); err != nil {
+		return "", err
+	}
+	filename := path.Join(dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+snapshotSuffix)
+
+	// write to a temp file first so a failed write never leaves a partial snapshot
+	if err = writeSnapshot(filename+".tmp", snap); err != nil {
+		os.Remove(filename + ".tmp")
+		return "", err
+	}
+	if err = os.Rename(filename+".tmp", filename); err != nil {
+		return "", fmt.Errorf("save snapshot %s failed %v", filename, err)
+	}
+	if len(snap.PortErrors) > 0 {
+		utils.ColorPrintln(fmt.Sprintf("ports of %d cds can not be fetched, they are unknown in snapshot", len(snap.PortErrors)), utils.Yellow)
+	}
+	oss.logger.Printf("save snapshot %s", filename)
+	return filename, nil
+}
+
+func writeSnapshot(filename string, snap *snapshot) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create file %s failed %v", filename, err)
+	}
+	defer f.Close()
+
+	w := gzip.NewWriter(f)
+	if err = json.NewEncoder(w).Encode(snap); err != nil {
+		return fmt.Errorf("write snapshot %s failed %v", filename, err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("write snapshot %s failed %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("write snapshot %s failed %v", filename, err)
+	}
+	return nil
+}
+
+// fetchSnapshot fetches cds list, label members, ports and nem nodes from api
+func (oss *OSS) fetchSnapshot(now time.Time) (*snapshot, error) {
+	data, err := oss.listCDS()
+	if err != nil {
+		return nil, err
+	}
+	labelList, err := oss.getLabels()
+	if err != nil {
+		return nil, err
+	}
+	nodeList, err := oss.getNemNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{
+		CreatedAt:  now.UTC(),
+		CDS:        data.CDS,
+		Ports:      make(map[string]*portInfo),
+		PortErrors: make(map[string]string),
+		NemNodes:   nodeList.List,
+	}
+
+	wg := &sync.WaitGroup{}
+	mu := &sync.Mutex{}
+	errs := make(chan error, len(labelList.Labels))
+	in := make(chan string)
+
+	for _, l := range labelList.Labels {
+		wg.Add(1)
+		go func(l *label) {
+			defer wg.Done()
+			list, err := oss.getCDSListByLabel(l.ID)
+			if err != nil {
+				errs <- err
+				return
+			}
+			sl := &snapshotLabel{ID: l.ID, Name: l.Name}
+			for _, cds := range list.CDS {
+				sl.SN = append(sl.SN, cds.SN)
+			}
+			sort.Strings(sl.SN)
+			mu.Lock()
+			snap.Labels = append(snap.Labels, sl)
+			mu.Unlock()
+		}(l)
+	}
+
+	for i := 0; i < oss.settings.Report.CDSWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sn := range in {
+				port, err := oss.getCDSPort(sn)
+				if err != nil {
+					oss.logger.Printf("get ports of %s failed %v", sn, err)
+					mu.Lock()
+					snap.PortErrors[sn] = err.Error()
+					mu.Unlock()
+					continue
+				}
+				mu.Lock()
+				snap.Ports[sn] = port
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, cds := range data.CDS {
+		in <- cds.SN
+	}
+	close(in)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	sort.Slice(snap.Labels, func(i, j int) bool { return snap.Labels[i].ID < snap.Labels[j].ID })
+	return snap, nil
+}
+
+// snapshotNames returns names of saved snapshots from old to new
+func snapshotNames() ([]string, error) {
+	dir := path.Join(confDir(), snapshotDir)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot dir %s failed %v", dir, err)
+	}
+
+	var names []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), snapshotPrefix) && strings.HasSuffix(f.Name(), snapshotSuffix) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// loadSnapshot loads snapshot from file path or name in snapshot dir
+func loadSnapshot(name string) (*snapshot, error) {
+	filename := name
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		filename = path.Join(confDir(), snapshotDir, name)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot %s failed %v", name, err)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot %s failed %v", name, err)
+	}
+	defer r.Close()
+
+	snap := new(snapshot)
+	if err = json.NewDecoder(r).Decode(snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s failed %v", name, err)
+	}
+	return snap, nil
+}
+
+// diffSnapshots compares two snapshots and returns changes sorted by sn
+func diffSnapshots(a, b *snapshot) []*snapshotChange {
+	var changes []*snapshotChange
+	add := func(kind, sn, before, after string) {
+		changes = append(changes, &snapshotChange{kind: kind, sn: sn, before: before, after: after})
+	}
+
+	before, after := make(map[string]*cdsInfo), make(map[string]*cdsInfo)
+	for _, cds := range a.CDS {
+		before[cds.SN] = cds
+	}
+	for _, cds := range b.CDS {
+		after[cds.SN] = cds
+	}
+
+	for sn, old := range before {
+		if _, ok := after[sn]; !ok {
+			add("cds removed", sn, old.Company, "")
+		}
+	}
+	for sn, cds := range after {
+		old, ok := before[sn]
+		if !ok {
+			add("cds added", sn, "", cds.Company)
+			continue
+		}
+		if old.Status != cds.Status {
+			add("status", sn, old.Status, cds.Status)
+		}
+		if old.Version != cds.Version {
+			add("version", sn, old.Version, cds.Version)
+		}
+		diffNodes(old, cds, add)
+	}
+
+	// ports which can not be fetched are unknown, they are shown instead of skipped silently
+	for sn, old := range a.Ports {
+		if _, ok := b.PortErrors[sn]; ok {
+			add("ssh port", sn, formatPort(old), "unknown")
+		}
+	}
+	for sn, port := range b.Ports {
+		old, ok := a.Ports[sn]
+		if !ok {
+			if _, ok := a.PortErrors[sn]; ok {
+				add("ssh port", sn, "unknown", formatPort(port))
+			}
+			continue
+		}
+		if formatPort(old) != formatPort(port) {
+			add("ssh port", sn, formatPort(old), formatPort(port))
+		}
+	}
+
+	beforeLabels, afterLabels := labelMembers(a.Labels), labelMembers(b.Labels)
+	for key := range beforeLabels {
+		if !afterLabels[key] {
+			add("label removed", key[1], key[0], "")
+		}
+	}
+	for key := range afterLabels {
+		if !beforeLabels[key] {
+			add("label added", key[1], "", key[0])
+		}
+	}
+
+	beforeNem, afterNem := nemBindings(a.NemNodes), nemBindings(b.NemNodes)
+	for sn, cdsSN := range afterNem {
+		if beforeNem[sn] != cdsSN {
+			add("nem binding", sn, beforeNem[sn], cdsSN)
+		}
+	}
+	for sn, cdsSN := range beforeNem {
+		if _, ok := afterNem[sn]; !ok {
+			add("nem binding", sn, cdsSN, "")
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].sn != changes[j].sn {
+			return changes[i].sn < changes[j].sn
+		}
+		if changes[i].kind != changes[j].kind {
+			return changes[i].kind < changes[j].kind
+		}
+		return changes[i].before+changes[i].after < changes[j].before+changes[j].after
+	})
+	return changes
+}
+
+func diffNodes(a, b *cdsInfo, add func(kind, sn, before, after string)) {
+	before := make(map[string]*node)
+	for _, n := range a.Nodes {
+		before[n.SN] = n
+	}
+	after := make(map[string]*node)
+	for _, n := range b.Nodes {
+		after[n.SN] = n
+		old, ok := before[n.SN]
+		if !ok {
+			add("node added", b.SN, "", n.SN+" "+n.Type)
+			continue
+		}
+		if old.Status != n.Status {
+			add("node status", b.SN, n.SN+" "+old.Status, n.SN+" "+n.Status)
+		}
+	}
+	for _, n := range a.Nodes {
+		if _, ok := after[n.SN]; !ok {
+			add("node removed", a.SN, n.SN+" "+n.Type, "")
+		}
+	}
+}
+
+// labelMembers returns set of [label name, cds sn]
+func labelMembers(labels []*snapshotLabel) map[[2]string]bool {
+	members := make(map[[2]string]bool)
+	for _, l := range labels {
+		for _, sn := range l.SN {
+			members[[2]string{l.Name, sn}] = true
+		}
+	}
+	return members
+}
+
+// nemBindings returns mapping of nem node sn to its binded cds sn
+func nemBindings(nodes []*nemNode) map[string]string {
+	bindings := make(map[string]string)
+	for _, n := range nodes {
+		if n.CdsSN != "" {
+			bindings[n.SN] = n.CdsSN
+		}
+	}
+	return bindings
+}
+
+func formatPort(port *portInfo) string {
+	return fmt.Sprintf("%s:%d", port.SSHHost, port.SSHPort)
+}
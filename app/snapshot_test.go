@@ -0,0 +1,55 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	a := &snapshot{
+		CDS: []*cdsInfo{
+			{SN: "CAS1", Company: "a", Status: "healthy", Version: "1.0", Nodes: []*node{{SN: "N1", Type: "icache", Status: "healthy"}}},
+			{SN: "CAS2", Company: "b", Status: "healthy", Version: "1.0"},
+			{SN: "CAS4", Company: "d", Status: "healthy", Version: "1.0"},
+		},
+		Labels:   []*snapshotLabel{{ID: 1, Name: "L1", SN: []string{"CAS1", "CAS2"}}},
+		Ports:    map[string]*portInfo{"CAS1": {SSHHost: "h", SSHPort: 22}, "CAS4": {SSHHost: "h", SSHPort: 22}},
+		NemNodes: []*nemNode{{SN: "NEM1", CdsSN: "CAS1"}},
+	}
+	b := &snapshot{
+		CDS: []*cdsInfo{
+			{SN: "CAS1", Company: "a", Status: "offline", Version: "1.1", Nodes: []*node{{SN: "N1", Type: "icache", Status: "offline"}}},
+			{SN: "CAS3", Company: "c", Status: "healthy", Version: "1.0"},
+			{SN: "CAS4", Company: "d", Status: "healthy", Version: "1.0"},
+		},
+		Labels:     []*snapshotLabel{{ID: 1, Name: "L1", SN: []string{"CAS1", "CAS3"}}},
+		Ports:      map[string]*portInfo{"CAS1": {SSHHost: "h", SSHPort: 2222}},
+		PortErrors: map[string]string{"CAS4": "timeout"},
+		NemNodes:   []*nemNode{{SN: "NEM1", CdsSN: "CAS3"}},
+	}
+
+	want := []snapshotChange{
+		{"node status", "CAS1", "N1 healthy", "N1 offline"},
+		{"ssh port", "CAS1", "h:22", "h:2222"},
+		{"status", "CAS1", "healthy", "offline"},
+		{"version", "CAS1", "1.0", "1.1"},
+		{"cds removed", "CAS2", "b", ""},
+		{"label removed", "CAS2", "L1", ""},
+		{"cds added", "CAS3", "", "c"},
+		{"label added", "CAS3", "", "L1"},
+		{"ssh port", "CAS4", "h:22", "unknown"},
+		{"nem binding", "NEM1", "CAS1", "CAS3"},
+	}
+
+	got := diffSnapshots(a, b)
+	if len(got) != len(want) {
+		for _, c := range got {
+			t.Logf("%+v", *c)
+		}
+		t.Fatalf("diffSnapshots got %d changes != want %d changes", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("change %d got: %+v != want: %+v", i, *got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+// ShowCDSStale shows cds and nodes whose updated_at is older than the given duration
+func (oss *OSS) ShowCDSStale(now time.Time, olderThan time.Duration) error {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	var results []*staleResult
+	for _, ret := range staleResults(data.CDS, now, oss.settings.location) {
+		if !ret.known || ret.age > olderThan {
+			results = append(results, ret)
+		}
+	}
+
+	if len(results) == 0 {
+		utils.SuccessPrintln(fmt.Sprintf("No cds or node is older than %s", olderThan))
+		return nil
+	}
+
+	headers := []string{"#", "type", "sn", "cds_sn", "company", "status", "updated_at", "last_seen"}
+	var content [][]string
+	for index, ret := range results {
+		index++
+		age := "unknown"
+		if ret.known {
+			age = utils.FormatAgo(ret.age)
+		}
+		content = append(content, []string{
+			strconv.Itoa(index),
+			ret.kind,
+			ret.sn,
+			ret.cdsSN,
+			ret.company,
+			ret.status,
+			ret.updatedAt,
+			age,
+		})
+	}
+	utils.PrintTable(headers, content)
+	return nil
+}
+
+// staleResults computes the age of every cds and node sorted by age desc,
+// items with unparsable updated_at are placed at the end.
+func staleResults(cdsList []*cdsInfo, now time.Time, l *time.Location) []*staleResult {
+	var results []*staleResult
+
+	for _, cds := range cdsList {
+		ret := &staleResult{kind: "cds", sn: cds.SN, cdsSN: cds.SN, company: cds.Company, status: cds.Status, updatedAt: cds.UpdatedAt}
+		if t, err := utils.ParseTime(cds.UpdatedAt, l); err == nil {
+			ret.age, ret.known = now.Sub(t), true
+		}
+		results = append(results, ret)
+
+		for _, node := range cds.Nodes {
+			// nodes without their own updated_at are covered by the cds row
+			if node.UpdatedAt == "" {
+				continue
+			}
+			nodeRet := &staleResult{kind: node.Type, sn: node.SN, cdsSN: cds.SN, company: cds.Company, status: node.Status, updatedAt: node.UpdatedAt}
+			if t, err := utils.ParseTime(node.UpdatedAt, l); err == nil {
+				nodeRet.age, nodeRet.known = now.Sub(t), true
+			}
+			results = append(results, nodeRet)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].known != results[j].known {
+			return results[i].known
+		}
+		return results[i].age > results[j].age
+	})
+	return results
+}
+
+// lastSeen formats updated_at as relative time likes `3h ago`
+func lastSeen(updatedAt string, now time.Time, l *time.Location) string {
+	t, err := utils.ParseTime(updatedAt, l)
+	if err != nil {
+		return "-"
+	}
+	return utils.FormatAgo(now.Sub(t))
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/super1-chen/fxoss/utils"
+)
+
+type nodeKey struct {
+	nodeType, status string
+}
+
+// ShowCDSStats shows summary tables aggregated from all cds list
+func (oss *OSS) ShowCDSStats() error {
+
+	data, err := oss.getCDSList()
+	if err != nil {
+		return err
+	}
+
+	if len(data.CDS) == 0 {
+		utils.ColorPrintln("CDS list is empty", utils.Yellow)
+		return nil
+	}
+
+	statusCounts := make(map[string]int64)
+	versionCounts := make(map[string]int64)
+	nodeCounts := make(map[nodeKey]int64)
+	var online, onlineMax, hit, hitMax int64
+	var service, serviceMax, cache, cacheMax, monitor, monitorMax int64
+
+	for _, cds := range data.CDS {
+		statusCounts[utils.StatusKind(cds.Status)]++
+		versionCounts[cds.Version]++
+		online += cds.OnlineUser
+		onlineMax += cds.OnlineUserMax
+		hit += cds.HitUser
+		hitMax += cds.HitUserMax
+		service += cds.ServiceKbps
+		serviceMax += cds.ServiceKbpsMax
+		cache += cds.CacheKbps
+		cacheMax += cds.CacheKbpsMax
+		monitor += cds.MonitorKbps
+		monitorMax += cds.MonitorKbpsMax
+
+		for _, node := range cds.Nodes {
+			nodeCounts[nodeKey{node.Type, utils.StatusKind(node.Status)}]++
+		}
+	}
+
+	utils.SuccessPrintln(fmt.Sprintf("CDS total: %d", len(data.CDS)))
+	utils.PrintTable([]string{"status", "count"}, utils.CountRows(statusCounts))
+	utils.PrintTable([]string{"version", "count"}, utils.CountRows(versionCounts))
+
+	labelList, err := oss.getLabels()
+	if err != nil {
+		oss.logger.Printf("%v", err)
+		utils.ErrorPrintln("获取cds-lables信息失败", false)
+	} else {
+		labelCounts := make(map[string]int64)
+		for _, l := range labelList.Labels {
+			labelCounts[l.Name] = l.Count
+		}
+		utils.PrintTable([]string{"label", "count"}, utils.CountRows(labelCounts))
+	}
+
+	// max is the sum of maxima of every cds, they are not reached at the same time
+	headers := []string{"metric", "total", "sum of max", "usage"}
+	content := [][]string{
+		statsRow("online_user", online, onlineMax),
+		statsRow("hit_user", hit, hitMax),
+		statsRow("service_kbps", service, serviceMax),
+		statsRow("cache_kbps", cache, cacheMax),
+		statsRow("monitor_kbps", monitor, monitorMax),
+	}
+	utils.PrintTable(headers, content)
+
+	if len(nodeCounts) == 0 {
+		utils.ColorPrintln("Nodes list is empty", utils.Yellow)
+		return nil
+	}
+
+	keys := make([]nodeKey, 0, len(nodeCounts))
+	for key := range nodeCounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].nodeType != keys[j].nodeType {
+			return keys[i].nodeType < keys[j].nodeType
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	var nodeContent [][]string
+	for _, key := range keys {
+		nodeContent = append(nodeContent, []string{key.nodeType, key.status, strconv.FormatInt(nodeCounts[key], 10)})
+	}
+	utils.PrintTable([]string{"node_type", "status", "count"}, nodeContent)
+
+	return nil
+}
+
+func statsRow(name string, value, maxValue int64) []string {
+	return []string{
+		name,
+		strconv.FormatInt(value, 10),
+		strconv.FormatInt(maxValue, 10),
+		utils.FormatPercent(value, maxValue),
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// alerts partion
+	rulesFile     *string
+	alertInterval *string
+)
+
+func init() {
+	// alerts partion
+	rootCmd.AddCommand(alertsCmd)
+	alertsCmd.AddCommand(alertsCheckCmd)
+	alertsCmd.AddCommand(alertsRunCmd)
+	rulesFile = alertsCmd.PersistentFlags().StringP("rules", "r", "", "alert rules yaml file (default $FXOSS_DIR/fx_alerts.yaml)")
+	alertInterval = alertsRunCmd.Flags().StringP("interval", "i", "1m", "evaluate interval")
+}
+
+// alerts partion
+var alertsCmd = &cobra.Command{
+	Use:   "alerts",
+	Short: "Evaluate alert rules against cds, nodes and disks",
+	Long:  `fxoss alerts check|run`,
+}
+
+var alertsCheckCmd = &cobra.Command{
+	Use:     "check",
+	Short:   "Evaluate alert rules once and show pending and firing alerts",
+	Long:    `fxoss alerts check evaluates alert rules once, it exits with 1 if any alert fires`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runAlertsCheck,
+	Args:    cobra.NoArgs,
+	Example: "fxoss alerts check --rules fx_alerts.yaml",
+	// firing and resolved alerts of the check are sent instead of its output
+	Annotations: map[string]string{notifySelf: "true"},
+}
+
+func runAlertsCheck(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	app.SetNotify(*notifyNames, *notifyDryRun)
+	count, err := app.CheckAlerts(now, *rulesFile)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if count > 0 {
+		utils.ErrorPrintln(fmt.Sprintf("%d alerts are firing", count), true)
+	}
+}
+
+var alertsRunCmd = &cobra.Command{
+	Use:     "run",
+	Short:   "Evaluate alert rules continuously",
+	Long:    `fxoss alerts run evaluates alert rules on an interval and prints or sends firing and resolved alerts, state is kept in $FXOSS_DIR/alerts`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runAlertsRun,
+	Args:    cobra.NoArgs,
+	Example: "fxoss alerts run --interval 1m --notify oncall",
+	// firing and resolved alerts are sent on every evaluation
+	Annotations: map[string]string{notifySelf: "true"},
+}
+
+func runAlertsRun(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	d, err := utils.ParseDuration(*alertInterval)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if d <= 0 {
+		utils.ErrorPrintln(fmt.Sprintf("illegal interval %q", *alertInterval), true)
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	app.SetNotify(*notifyNames, *notifyDryRun)
+	err = app.RunAlerts(d, *rulesFile)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
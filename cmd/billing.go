@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// billing partion
+	month  *string
+	output *string
+)
+
+func init() {
+	// billing partion
+	rootCmd.AddCommand(billingCmd)
+	month = billingCmd.Flags().StringP("month", "m", "", "billing month formatted as 2006-01 (default last month)")
+	output = billingCmd.Flags().StringP("output", "o", "", "save the billing report as xlsx file")
+}
+
+// billing partion
+var billingCmd = &cobra.Command{
+	Use:     "billing",
+	Short:   "Show 95th-percentile bandwidth billing per customer",
+	Long:    `fxoss billing computes p95, peak and average service bandwidth per company and per cds from local history`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runBilling,
+	Args:    cobra.NoArgs,
+	Example: "fxoss billing --month 2026-09 --output billing-2026-09.xlsx",
+}
+
+func runBilling(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowBilling(now, *month, *output)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// cds capacity partion
+	high *float64
+	low  *float64
+)
+
+func init() {
+	// cds capacity partion
+	rootCmd.AddCommand(cdsCapacityCmd)
+	high = cdsCapacityCmd.Flags().Float64("high", 0.9, "worst current/max ratio from which a cds is over-utilised")
+	low = cdsCapacityCmd.Flags().Float64("low", 0.1, "worst current/max ratio below which a cds is under-utilised")
+}
+
+// cds capacity partion
+var cdsCapacityCmd = &cobra.Command{
+	Use:     "cds-capacity",
+	Short:   "Show cds capacity and utilisation analytics",
+	Long:    `fxoss cds-capacity ranks over-utilised, under-utilised and anomalous cds by current/max ratios`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCDSCapacity,
+	Args:    cobra.NoArgs,
+	Example: "fxoss cds-capacity --high 0.9 --low 0.1",
+}
+
+func runCDSCapacity(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	if *low < 0 || *high > 1 || *low >= *high {
+		utils.ErrorPrintln(fmt.Sprintf("illegal ratio --low %v --high %v", *low, *high), false)
+		return
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowCDSCapacity(*high, *low)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
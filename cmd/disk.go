@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// disk health partion
+	maxUtil  *float64
+	maxAwait *float64
+	maxUsage *float64
+)
+
+func init() {
+	// cds disks partion
+	rootCmd.AddCommand(cdsDisksCmd)
+	// disk health partion
+	rootCmd.AddCommand(diskHealthCmd)
+	maxUtil = diskHealthCmd.Flags().Float64("util", 90, "util percent from which a disk is busy")
+	maxAwait = diskHealthCmd.Flags().Float64("await", 100, "await milliseconds from which a disk is slow")
+	maxUsage = diskHealthCmd.Flags().Float64("usage", 0.9, "used/size ratio from which a disk is nearly full")
+}
+
+// cds disks partion
+var cdsDisksCmd = &cobra.Command{
+	Use:     "cds-disks",
+	Short:   "Show cds disks information",
+	Long:    `fxoss cds-disks sn`,
+	Args:    requiredSN,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCDSDisks,
+}
+
+func runCDSDisks(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowCDSDisks(args[0])
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
+
+// disk health partion
+var diskHealthCmd = &cobra.Command{
+	Use:     "disk-health",
+	Short:   "Scan disks of all cds and show unhealthy disks",
+	Long:    `fxoss disk-health lists failed disks, busy or slow disks and nearly full disks of all cds`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runDiskHealth,
+	Args:    cobra.NoArgs,
+	Example: "fxoss disk-health --util 90 --await 100 --usage 0.9",
+}
+
+func runDiskHealth(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowDiskHealth(*maxUtil, *maxAwait, *maxUsage)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
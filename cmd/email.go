@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(emailCmd)
+	emailCmd.AddCommand(emailTestCmd)
+}
+
+// email partion
+var emailCmd = &cobra.Command{
+	Use:   "email",
+	Short: "Manage smtp settings of fx_email.json",
+	Long:  `fxoss email test`,
+}
+
+var emailTestCmd = &cobra.Command{
+	Use:     "test [address]...",
+	Short:   "Send a probe email to check smtp settings",
+	Long:    `fxoss email test connects the smtp server of fx_email.json and sends a probe email to the addresses, or to the sender itself if no address is given`,
+	Run:     runEmailTest,
+	Example: "fxoss email test someone@fxdata.cn",
+}
+
+func runEmailTest(cmd *cobra.Command, args []string) {
+	if err := app.TestEmail(*debug, args...); err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
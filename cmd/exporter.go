@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// exporter partion
+	listen  *string
+	refresh *string
+)
+
+func init() {
+	// exporter partion
+	rootCmd.AddCommand(exporterCmd)
+	listen = exporterCmd.Flags().StringP("listen", "l", ":9400", "address to serve metrics")
+	refresh = exporterCmd.Flags().StringP("refresh", "r", "1m", "interval to refresh metrics from api")
+}
+
+// exporter partion
+var exporterCmd = &cobra.Command{
+	Use:     "exporter",
+	Short:   "Serve cds metrics for prometheus",
+	Long:    `fxoss exporter serves /metrics in prometheus text format from a cache refreshed in background`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runExporter,
+	Args:    cobra.NoArgs,
+	Example: "fxoss exporter --listen :9400 --refresh 1m",
+}
+
+func runExporter(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	d, err := utils.ParseDuration(*refresh)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if d <= 0 {
+		utils.ErrorPrintln(fmt.Sprintf("illegal refresh %q", *refresh), true)
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	err = app.RunExporter(*listen, d)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// collect partion
+	interval *string
+	once     *bool
+	// cds history partion
+	since *string
+)
+
+func init() {
+	// collect partion
+	rootCmd.AddCommand(collectCmd)
+	interval = collectCmd.Flags().StringP("interval", "i", "", "poll interval, such as 1m (default history.interval of settings)")
+	once = collectCmd.Flags().Bool("once", false, "poll only once then exit, used by cron")
+	// cds history partion
+	rootCmd.AddCommand(cdsHistoryCmd)
+	since = cdsHistoryCmd.Flags().StringP("since", "s", "7d", "show history since the duration ago")
+}
+
+// collect partion
+var collectCmd = &cobra.Command{
+	Use:     "collect",
+	Short:   "Collect cds metrics into local history",
+	Long:    `fxoss collect polls cds list on an interval and saves metrics of cds and nodes into local history`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCollect,
+	Args:    cobra.NoArgs,
+	Example: "fxoss collect --interval 1m",
+}
+
+func runCollect(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	var d time.Duration
+	var err error
+	if *interval != "" {
+		d, err = utils.ParseDuration(*interval)
+		if err != nil {
+			utils.ErrorPrintln(err.Error(), true)
+		}
+		if d <= 0 {
+			utils.ErrorPrintln(fmt.Sprintf("illegal interval %q", *interval), true)
+		}
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	err = app.Collect(d, *once)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
+
+// cds history partion
+var cdsHistoryCmd = &cobra.Command{
+	Use:     "cds-history",
+	Short:   "Show cds metrics history",
+	Long:    `fxoss cds-history sn shows sparklines and min/avg/max/p95 of cds and nodes metrics from local history`,
+	Args:    requiredSN,
+	Run:     runCDSHistory,
+	Example: "fxoss cds-history CAS0530000102 --since 7d",
+}
+
+func runCDSHistory(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+
+	d, err := utils.ParseDuration(*since)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+
+	// history is read from local files, the api token is not needed
+	app, err := app.NewLocalServer(*debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowCDSHistory(now, args[0], d)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+func init() {
+	// hostkey partion
+	rootCmd.AddCommand(hostkeyCmd)
+	hostkeyCmd.AddCommand(hostkeyListCmd)
+	hostkeyCmd.AddCommand(hostkeyForgetCmd)
+	hostkeyCmd.AddCommand(hostkeyPinCmd)
+}
+
+// hostkey partion
+var hostkeyCmd = &cobra.Command{
+	Use:   "hostkey",
+	Short: "Manage ssh host keys of cds used by cds-login",
+	Long:  `fxoss hostkey list|forget|pin`,
+}
+
+var hostkeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show known host keys of cds",
+	Long:  `fxoss hostkey list`,
+	Run:   runHostkeyList,
+	Args:  cobra.NoArgs,
+}
+
+func runHostkeyList(cmd *cobra.Command, args []string) {
+	app, err := app.NewLocalServer(*debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if err = app.ShowHostKeys(); err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
+
+var hostkeyForgetCmd = &cobra.Command{
+	Use:     "forget <sn>",
+	Short:   "Remove the host key of cds, it is trusted again on next login",
+	Long:    `fxoss hostkey forget removes the known host key of cds, use it only if the host key of the cds is really changed`,
+	Run:     runHostkeyForget,
+	Args:    cobra.ExactArgs(1),
+	Example: "fxoss hostkey forget CAS0530000102",
+}
+
+func runHostkeyForget(cmd *cobra.Command, args []string) {
+	if err := app.ForgetHostKey(args[0]); err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
+
+var hostkeyPinCmd = &cobra.Command{
+	Use:     "pin <sn> <public key|file>",
+	Short:   "Set the host key of cds",
+	Long:    `fxoss hostkey pin sets the host key of cds to the public key, such as /etc/ssh/ssh_host_ed25519_key.pub of the cds, instead of trusting the key on first login`,
+	Run:     runHostkeyPin,
+	Args:    cobra.ExactArgs(2),
+	Example: "fxoss hostkey pin CAS0530000102 ssh_host_ed25519_key.pub\nfxoss hostkey pin CAS0530000102 \"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAA...\"",
+}
+
+func runHostkeyPin(cmd *cobra.Command, args []string) {
+	if err := app.PinHostKey(args[0], args[1]); err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// cds license partion
+	within *string
+)
+
+func init() {
+	// cds license partion
+	rootCmd.AddCommand(cdsLicenseCmd)
+	within = cdsLicenseCmd.Flags().StringP("within", "w", "30d", "show cds whose license expires within the duration, such as 30d, 2w or 12h")
+}
+
+// cds license partion
+var cdsLicenseCmd = &cobra.Command{
+	Use:     "cds-license",
+	Short:   "Show cds whose license will expire",
+	Long:    `fxoss cds-license lists cds whose license expires within the given duration and exits with status 1 if any`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCDSLicense,
+	Args:    cobra.NoArgs,
+	Example: "fxoss cds-license --within 30d",
+}
+
+func runCDSLicense(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	d, err := utils.ParseDuration(*within)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	count, err := app.ShowCDSLicense(now, d)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if count > 0 {
+		utils.ErrorPrintln(fmt.Sprintf("%d cds license expires within %s", count, *within), true)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// node list partion
+	nodeType   *string
+	nodeStatus *string
+)
+
+func init() {
+	// node list partion
+	rootCmd.AddCommand(nodeListCmd)
+	nodeType = nodeListCmd.Flags().StringP("type", "T", "", "filter nodes by type, such as icache")
+	nodeStatus = nodeListCmd.Flags().StringP("status", "s", "", "filter nodes by status, such as healthy or offline")
+	// node show partion
+	rootCmd.AddCommand(nodeShowCmd)
+}
+
+func requiredNodeSN(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("node sn is required")
+	}
+	return nil
+}
+
+// node list partion
+var nodeListCmd = &cobra.Command{
+	Use:     "node-list",
+	Short:   "Show nodes of all cds",
+	Long:    `fxoss node-list shows nodes across the fleet with their parent cds sn and company`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runNodeList,
+	Args:    cobra.NoArgs,
+	Example: "fxoss node-list --type icache --status offline",
+}
+
+func runNodeList(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowNodeList(*nodeType, *nodeStatus)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
+
+// node show partion
+var nodeShowCmd = &cobra.Command{
+	Use:     "node-show",
+	Short:   "Show node detail info and its parent cds",
+	Long:    `fxoss node-show node_sn`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runNodeShow,
+	Args:    requiredNodeSN,
+}
+
+func runNodeShow(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowNodeDetail(args[0])
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// notify partion
+	notifyNames  *[]string
+	notifyDryRun *bool
+	notifyOnce   sync.Once
+)
+
+// notifySelf marks commands sending notifications by themselves, their output is not sent
+const notifySelf = "notify-self"
+
+func init() {
+	// notify partion
+	notifyNames = rootCmd.PersistentFlags().StringSlice("notify", nil, "send output of the command to the named notifiers of settings")
+	notifyDryRun = rootCmd.PersistentFlags().Bool("notify-dry-run", false, "print notification payloads instead of sending them")
+	rootCmd.PersistentPreRun = startNotify
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) { sendNotify(cmd, args) }
+	rootCmd.AddCommand(notifyCmd)
+	notifyCmd.AddCommand(notifyTestCmd)
+}
+
+// notify partion
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Manage notifiers of chat bots and webhooks",
+	Long:  `fxoss notify test`,
+}
+
+var notifyTestCmd = &cobra.Command{
+	Use:     "test <name>...",
+	Short:   "Send a test message to notifiers",
+	Long:    `fxoss notify test sends a test message to the named notifiers of settings`,
+	Args:    cobra.MinimumNArgs(1),
+	Run:     runNotifyTest,
+	Example: "fxoss notify test oncall --notify-dry-run",
+}
+
+func runNotifyTest(cmd *cobra.Command, args []string) {
+	err := app.Notify(args, *notifyDryRun, *debug, "fxoss test message", "It works.")
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if !*notifyDryRun {
+		utils.SuccessPrintln("发送通知成功: " + strings.Join(args, ", "))
+	}
+}
+
+// startNotify records output of the command if notifiers are given
+func startNotify(cmd *cobra.Command, args []string) {
+	if len(*notifyNames) == 0 || cmd.Annotations[notifySelf] != "" {
+		return
+	}
+	utils.StartRecord()
+	utils.OnExit(func() { sendNotify(cmd, args) })
+}
+
+// sendNotify sends recorded output of the command to notifiers once
+func sendNotify(cmd *cobra.Command, args []string) {
+	notifyOnce.Do(func() {
+		text := utils.Recorded()
+		if len(*notifyNames) == 0 || cmd.Annotations[notifySelf] != "" || text == "" {
+			return
+		}
+		title := strings.TrimSpace(cmd.CommandPath() + " " + strings.Join(args, " "))
+		if err := app.Notify(*notifyNames, *notifyDryRun, *debug, title, text); err != nil {
+			utils.ErrorPrintln(err.Error(), false)
+		}
+	})
+}
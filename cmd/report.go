@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// report partion
+	runEmails  *[]string
+	runCC      *[]string
+	runBCC     *[]string
+	runReplyTo *string
+	runFormat  *string
+	runOutput  *string
+	runNoEmail *bool
+	runFailMax *float64
+)
+
+func init() {
+	// report partion
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportListCmd)
+	reportCmd.AddCommand(reportRunCmd)
+	runEmails = reportRunCmd.Flags().StringSliceP("email", "e", nil, "send the report to the addresses, the report is kept in config dir if it is empty")
+	runCC = reportRunCmd.Flags().StringSlice("cc", nil, "cc addresses of the report email, added to cc of fx_email.json")
+	runBCC = reportRunCmd.Flags().StringSlice("bcc", nil, "bcc addresses of the report email, added to bcc of fx_email.json")
+	runReplyTo = reportRunCmd.Flags().String("reply-to", "", "reply-to address of the report email, overrides reply_to of fx_email.json")
+	runFormat = reportRunCmd.Flags().StringP("format", "f", "", "report format "+strings.Join(app.ReportFormats(), "|")+" (default by extension of --output or xlsx)")
+	runOutput = reportRunCmd.Flags().StringP("output", "o", "", "keep the report at the path without email")
+	runNoEmail = reportRunCmd.Flags().Bool("no-email", false, "dry run, keep the report in config dir without email")
+	runFailMax = reportRunCmd.Flags().Float64("fail-threshold", 0.5, "abort sending if the ratio of failed fetches reaches it, 0 aborts on any failure")
+}
+
+// report partion
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "List and run reports of cds",
+	Long:  `fxoss report list|run`,
+}
+
+var reportListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List report types",
+	Long:  `fxoss report list shows types of reports which can be run by fxoss report run`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := app.ShowReportTypes(); err != nil {
+			utils.ErrorPrintln(err.Error(), true)
+		}
+	},
+}
+
+var reportRunCmd = &cobra.Command{
+	Use:     "run <type>",
+	Short:   "Run a report and send it by email",
+	Long:    `fxoss report run makes the report of type and sends it to --email, or keeps it locally`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Args:    reportRunArgs,
+	Run:     runReportType,
+	Example: "fxoss report run license --email someone@fxdata.cn\nfxoss report run license --email someone@fxdata.cn --no-email\nfxoss report run traffic --output traffic.csv",
+}
+
+// reportRunArgs requires a report type and valid --email addresses
+func reportRunArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+		return err
+	}
+	if err := validFailThreshold(*runFailMax); err != nil {
+		return err
+	}
+	if err := validCopyEmail(*runCC, *runBCC); err != nil {
+		return err
+	}
+	if len(*runEmails) == 0 {
+		return nil
+	}
+	return requiredValidEmail(cmd, *runEmails)
+}
+
+func runReportType(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+	opts := app.ReportOptions{
+		CC: *runCC, BCC: *runBCC, ReplyTo: *runReplyTo,
+		Format: *runFormat, Output: *runOutput, NoEmail: *runNoEmail,
+		FailThreshold: *runFailMax,
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if err = app.RunReport(now, args[0], opts, *runEmails...); err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
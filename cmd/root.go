@@ -25,6 +25,14 @@ var (
 	frpc    *bool
 	pwd     *string
 	version string
+	// cds report partion
+	reportCC      *[]string
+	reportBCC     *[]string
+	reportReplyTo *string
+	reportFormat  *string
+	reportOutput  *string
+	reportNoEmail *bool
+	reportFailMax *float64
 )
 
 var rootCmd = &cobra.Command{
@@ -55,6 +63,13 @@ func init() {
 	rootCmd.AddCommand(cdsShowDetail)
 	// make cds report partion
 	rootCmd.AddCommand(cdsReportShow)
+	reportCC = cdsReportShow.Flags().StringSlice("cc", nil, "cc addresses of the report email, added to cc of fx_email.json")
+	reportBCC = cdsReportShow.Flags().StringSlice("bcc", nil, "bcc addresses of the report email, added to bcc of fx_email.json")
+	reportReplyTo = cdsReportShow.Flags().String("reply-to", "", "reply-to address of the report email, overrides reply_to of fx_email.json")
+	reportFormat = cdsReportShow.Flags().StringP("format", "f", "", "report format "+strings.Join(app.ReportFormats(), "|")+" (default by extension of --output or xlsx)")
+	reportOutput = cdsReportShow.Flags().StringP("output", "o", "", "keep the report at the path without email")
+	reportNoEmail = cdsReportShow.Flags().Bool("no-email", false, "dry run, keep the report in config dir without email")
+	reportFailMax = cdsReportShow.Flags().Float64("fail-threshold", 0.5, "abort sending if the ratio of failed fetches reaches it, 0 aborts on any failure")
 	// make web root partion
 	rootCmd.AddCommand(cdsWebRoot)
 }
@@ -66,14 +81,22 @@ func requiredSN(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// requiredValidEmail requires email addresses or @groups allowed by fx_email.json
 func requiredValidEmail(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("one email address is required")
+		return fmt.Errorf("one email address or @group is required")
 	}
-	for _, arg := range args {
-		if !(strings.HasSuffix(arg, "@fxdata.cn") || strings.HasPrefix(arg, "@ifeixiang.com")) {
-			return fmt.Errorf("illegal format email %s", arg)
-		}
+	return app.ValidateRecipients(args)
+}
+
+// validCopyEmail checks --cc and --bcc addresses like the recipients before any request
+func validCopyEmail(cc, bcc []string) error {
+	addresses := append(append([]string{}, cc...), bcc...)
+	if len(addresses) == 0 {
+		return nil
+	}
+	if err := app.ValidateRecipients(addresses); err != nil {
+		return fmt.Errorf("--cc/--bcc: %v", err)
 	}
 	return nil
 }
@@ -145,7 +168,7 @@ func runCDSList(cmd *cobra.Command, args []string) {
 	if len(args) == 1 {
 		option = args[0]
 	}
-	err = app.ShowCDSList(option, *long)
+	err = app.ShowCDSList(now, option, *long)
 	if err != nil {
 		utils.ErrorPrintln(err.Error(), false)
 		return
@@ -175,7 +198,7 @@ func runLoginCDS(cmd *cobra.Command, args []string) {
 	if utils.IsAssertSN(args[0]) {
 		sn = args[0]
 	} else {
-		err = app.ShowCDSList(args[0], *long)
+		err = app.ShowCDSList(now, args[0], *long)
 		if err != nil {
 			utils.ErrorPrintln(err.Error(), false)
 		}
@@ -185,9 +208,10 @@ func runLoginCDS(cmd *cobra.Command, args []string) {
 		sn = strings.TrimSpace(sn)
 	}
 
+	// a changed host key exits with error status
 	err = app.LoginCDS(sn, *pwd, *r, *timeout, *frpc)
 	if err != nil {
-		utils.ErrorPrintln(err.Error(), false)
+		utils.ErrorPrintln(err.Error(), true)
 	}
 }
 
@@ -249,21 +273,49 @@ var cdsReportShow = &cobra.Command{
 	Long:    `fxoss cds-report chenc@fxdata.cn chenc@ifeixiang.com`,
 	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
 	Run:     runReport,
-	Args:    requiredValidEmail,
+	Args:    reportArgs,
+	Example: "fxoss cds-report --format csv --output cds.csv",
+}
+
+// reportArgs requires email addresses unless the report is kept locally
+func reportArgs(cmd *cobra.Command, args []string) error {
+	if err := validFailThreshold(*reportFailMax); err != nil {
+		return err
+	}
+	if err := validCopyEmail(*reportCC, *reportBCC); err != nil {
+		return err
+	}
+	if len(args) == 0 && (*reportOutput != "" || *reportNoEmail) {
+		return nil
+	}
+	return requiredValidEmail(cmd, args)
+}
+
+// validFailThreshold requires --fail-threshold in [0, 1]
+func validFailThreshold(threshold float64) error {
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("illegal --fail-threshold %v, it should be in [0, 1]", threshold)
+	}
+	return nil
 }
 
 func runReport(cmd *cobra.Command, args []string) {
 	now := time.Now().UTC()
 	config := conf.NewConfig()
+	opts := app.ReportOptions{
+		CC: *reportCC, BCC: *reportBCC, ReplyTo: *reportReplyTo,
+		Format: *reportFormat, Output: *reportOutput, NoEmail: *reportNoEmail,
+		FailThreshold: *reportFailMax,
+	}
 
 	app, err := app.NewOssServer(now, config, *debug)
 	if err != nil {
-		utils.ErrorPrintln(err.Error(), false)
-		return
+		utils.ErrorPrintln(err.Error(), true)
 	}
-	err = app.ReportCDS(now, args...)
+	// failed fetches exit with error status after the report is sent
+	err = app.ReportCDS(now, opts, args...)
 	if err != nil {
-		utils.ErrorPrintln(err.Error(), false)
+		utils.ErrorPrintln(err.Error(), true)
 	}
 }
 
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+func init() {
+	// scheduler partion
+	rootCmd.AddCommand(schedulerCmd)
+	schedulerCmd.AddCommand(schedulerStatusCmd)
+}
+
+// scheduler partion
+var schedulerCmd = &cobra.Command{
+	Use:     "scheduler",
+	Short:   "Run jobs of settings on cron schedules",
+	Long:    `fxoss scheduler runs fxoss commands of scheduler.jobs in settings on their cron schedules in one long-lived process`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runScheduler,
+	Args:    cobra.NoArgs,
+	Example: "fxoss scheduler",
+	// every job is a fxoss command which can notify by itself
+	Annotations: map[string]string{notifySelf: "true"},
+}
+
+func runScheduler(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	err = app.RunScheduler()
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
+
+var schedulerStatusCmd = &cobra.Command{
+	Use:     "status [job]",
+	Short:   "Show last and next runs of scheduler jobs",
+	Long:    `fxoss scheduler status shows the last and the next run of every job, or runs and the last log of the given job`,
+	Run:     runSchedulerStatus,
+	Args:    cobra.MaximumNArgs(1),
+	Example: "fxoss scheduler status daily-report",
+}
+
+func runSchedulerStatus(cmd *cobra.Command, args []string) {
+	job := ""
+	if len(args) > 0 {
+		job = args[0]
+	}
+	err := app.ShowSchedulerStatus(time.Now(), job, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
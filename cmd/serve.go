@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// serve partion
+	serveListen  *string
+	serveRefresh *string
+)
+
+func init() {
+	// serve partion
+	rootCmd.AddCommand(serveCmd)
+	serveListen = serveCmd.Flags().StringP("listen", "l", "127.0.0.1:8080", "address to serve api, listen on all interfaces only with serve.api_keys")
+	serveRefresh = serveCmd.Flags().StringP("refresh", "r", "5m", "interval to refresh data from oss api")
+}
+
+// serve partion
+var serveCmd = &cobra.Command{
+	Use:     "serve",
+	Short:   "Serve read-only json api of enriched fleet data",
+	Long:    `fxoss serve serves cds with labels, ports, disk tier and nem binding as json api from a cache refreshed in background`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runServe,
+	Args:    cobra.NoArgs,
+	Example: "fxoss serve --listen 127.0.0.1:8080 --refresh 5m",
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	d, err := utils.ParseDuration(*serveRefresh)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	if d <= 0 {
+		utils.ErrorPrintln(fmt.Sprintf("illegal refresh %q", *serveRefresh), true)
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+	err = app.Serve(*serveListen, d)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), true)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// sla partion
+	slaMonth *string
+)
+
+func init() {
+	// sla partion
+	rootCmd.AddCommand(slaCmd)
+	slaMonth = slaCmd.Flags().StringP("month", "m", "", "month formatted as 2006-01 (default last month)")
+}
+
+// sla partion
+var slaCmd = &cobra.Command{
+	Use:     "sla",
+	Short:   "Show monthly availability per cds and node",
+	Long:    `fxoss sla shows online percentage, outages, downtime and MTTR per cds and node from local history, polling gaps are reported separately`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runSLA,
+	Args:    cobra.NoArgs,
+	Example: "fxoss sla --month 2026-09",
+}
+
+func runSLA(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowSLA(now, *slaMonth)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+func init() {
+	// snapshot partion
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+}
+
+// snapshot partion
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save fleet snapshots and show changes between them",
+	Long:  `fxoss snapshot save|list|diff`,
+}
+
+var snapshotSaveCmd = &cobra.Command{
+	Use:     "save",
+	Short:   "Save cds, labels, ports and nem nodes state as a snapshot",
+	Long:    `fxoss snapshot save`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runSnapshotSave,
+	Args:    cobra.NoArgs,
+}
+
+func runSnapshotSave(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.SaveSnapshot(now)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show saved snapshots",
+	Long:  `fxoss snapshot list`,
+	Run:   runSnapshotList,
+	Args:  cobra.NoArgs,
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) {
+	err := app.ShowSnapshotList()
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:     "diff",
+	Short:   "Show changes between two snapshots",
+	Long:    `fxoss snapshot diff <a> <b>`,
+	Run:     runSnapshotDiff,
+	Args:    cobra.ExactArgs(2),
+	Example: "fxoss snapshot diff snapshot-20261018T000000Z.json.gz snapshot-20261019T000000Z.json.gz",
+}
+
+func runSnapshotDiff(cmd *cobra.Command, args []string) {
+	err := app.ShowSnapshotDiff(args[0], args[1])
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+var (
+	// cds stale partion
+	olderThan *string
+)
+
+func init() {
+	// cds stale partion
+	rootCmd.AddCommand(cdsStaleCmd)
+	olderThan = cdsStaleCmd.Flags().StringP("older-than", "o", "15m", "show cds and nodes whose updated_at is older than the duration")
+}
+
+// cds stale partion
+var cdsStaleCmd = &cobra.Command{
+	Use:     "cds-stale",
+	Short:   "Show cds and nodes which stop updating",
+	Long:    `fxoss cds-stale lists cds and nodes whose updated_at is older than the given duration, sorted by age`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCDSStale,
+	Args:    cobra.NoArgs,
+	Example: "fxoss cds-stale --older-than 15m",
+}
+
+func runCDSStale(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	d, err := utils.ParseDuration(*olderThan)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowCDSStale(now, d)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
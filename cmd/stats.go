@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/super1-chen/fxoss/app"
+	"github.com/super1-chen/fxoss/conf"
+	"github.com/super1-chen/fxoss/utils"
+)
+
+func init() {
+	// cds stats partion
+	rootCmd.AddCommand(cdsStatsCmd)
+}
+
+// cds stats partion
+var cdsStatsCmd = &cobra.Command{
+	Use:     "cds-stats",
+	Short:   "Show cds fleet statistics summary",
+	Long:    `fxoss cds-stats shows cds counts by status, version and label, users, bandwidth and nodes summary`,
+	PreRunE: func(cmd *cobra.Command, args []string) error { return app.CheckEnvironment() },
+	Run:     runCDSStats,
+	Args:    cobra.NoArgs,
+}
+
+func runCDSStats(cmd *cobra.Command, args []string) {
+	now := time.Now().UTC()
+	config := conf.NewConfig()
+
+	app, err := app.NewOssServer(now, config, *debug)
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+		return
+	}
+	err = app.ShowCDSStats()
+	if err != nil {
+		utils.ErrorPrintln(err.Error(), false)
+	}
+}
@@ -0,0 +1,53 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	l, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-09-01 is tuesday
+	base := time.Date(2026, 9, 1, 8, 30, 15, 0, l)
+	testCases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 9, 1, 8, 31, 0, 0, l)},
+		{"*/15 * * * *", time.Date(2026, 9, 1, 8, 45, 0, 0, l)},
+		{"0 9 * * *", time.Date(2026, 9, 1, 9, 0, 0, 0, l)},
+		{"0 8 * * *", time.Date(2026, 9, 2, 8, 0, 0, 0, l)},
+		{"30 8 * * 1-5", time.Date(2026, 9, 2, 8, 30, 0, 0, l)},
+		{"0 9 * * mon", time.Date(2026, 9, 7, 9, 0, 0, 0, l)},
+		{"0 0 * * 7", time.Date(2026, 9, 6, 0, 0, 0, 0, l)},
+		{"0 0 1 * *", time.Date(2026, 10, 1, 0, 0, 0, 0, l)},
+		{"@monthly", time.Date(2026, 10, 1, 0, 0, 0, 0, l)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, l)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, l)},
+		// day of month or day of week if both are restricted
+		{"0 0 15 * fri", time.Date(2026, 9, 4, 0, 0, 0, 0, l)},
+		{"5,10-12/2 22 * * *", time.Date(2026, 9, 1, 22, 5, 0, 0, l)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range testCases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error %v", c.expr, err)
+			continue
+		}
+		if got := s.Next(base); !got.Equal(c.want) {
+			t.Errorf("%q Next(%s) got %s != want %s", c.expr, base, got, c.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@every"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should return error", expr)
+		}
+	}
+}
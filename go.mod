@@ -8,7 +8,7 @@ require (
 	github.com/howeyc/gopass v0.0.0-20170109162249-bf9dde6d0d2c // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
-	github.com/mattn/go-runewidth v0.0.4 // indirect
+	github.com/mattn/go-runewidth v0.0.4
 	github.com/olekukonko/tablewriter v0.0.1
 	github.com/pelletier/go-toml v1.4.0 // indirect
 	github.com/scorredoira/email v0.0.0-20190509221456-365bb6a9fa0c
@@ -26,4 +26,5 @@ require (
 	golang.org/x/tools v0.0.0-20190501045030-23463209683d // indirect
 	golang.org/x/tour v0.0.0-20190318020441-db40fe78fefc // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,432 @@
+// Package history is a local time-series store of cds and node metrics
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	rawDir         = "raw"
+	downsampledDir = "downsampled"
+	transitionDir  = "transitions"
+	dayLayout      = "2006-01-02"
+	fileSuffix     = ".csv"
+)
+
+// Sample is metrics of a cds or a node at a time, a downsampled sample holds
+// average metrics of Count raw samples, the last status of them and the count of online ones.
+// A sample covers Count*Interval from its time.
+type Sample struct {
+	Time        time.Time
+	SN          string // sn of cds or node
+	CDSSN       string // sn of parent cds, equals SN for cds
+	Kind        string // `cds` or node type
+	Status      string
+	OnlineUser  int64
+	HitUser     int64
+	ServiceKbps int64
+	CacheKbps   int64
+	MonitorKbps int64
+	Count       int64
+	Online      int64         // count of raw samples whose status is online
+	Interval    time.Duration // poll interval of raw samples, 0 if it is unknown
+	Company     string        // company of the cds when the sample was polled
+}
+
+// Transition is a change of status between online and offline
+type Transition struct {
+	Time     time.Time
+	SN       string
+	CDSSN    string
+	Kind     string
+	From, To string
+}
+
+// Store saves samples as csv files per day (UTC), raw samples are downsampled after a retention
+type Store struct {
+	dir string
+}
+
+// New creates a store in the given dir
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Append appends raw samples to the store
+func (s *Store) Append(samples []*Sample) error {
+	days := make(map[string][]*Sample)
+	for _, sample := range samples {
+		day := sample.Time.UTC().Format(dayLayout)
+		days[day] = append(days[day], sample)
+	}
+
+	dir := path.Join(s.dir, rawDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("create history dir %s failed %v", dir, err)
+	}
+
+	for day, samples := range days {
+		filename := path.Join(dir, day+fileSuffix)
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("open history file %s failed %v", filename, err)
+		}
+		err = writeSamples(f, samples)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("write history file %s failed %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// AppendTransitions appends status transitions to the store
+func (s *Store) AppendTransitions(transitions []*Transition) error {
+	days := make(map[string][][]string)
+	for _, t := range transitions {
+		day := t.Time.UTC().Format(dayLayout)
+		days[day] = append(days[day], []string{
+			strconv.FormatInt(t.Time.Unix(), 10), t.SN, t.CDSSN, t.Kind, t.From, t.To,
+		})
+	}
+
+	dir := path.Join(s.dir, transitionDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("create history dir %s failed %v", dir, err)
+	}
+
+	for day, records := range days {
+		filename := path.Join(dir, day+fileSuffix)
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("open history file %s failed %v", filename, err)
+		}
+		w := csv.NewWriter(f)
+		w.WriteAll(records)
+		f.Close()
+		if err = w.Error(); err != nil {
+			return fmt.Errorf("write history file %s failed %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// Transitions returns status transitions between since and until sorted by time,
+// transitions are filtered by match if it is not nil.
+func (s *Store) Transitions(since, until time.Time, match func(*Transition) bool) ([]*Transition, error) {
+	var results []*Transition
+
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(until); day = day.Add(24 * time.Hour) {
+		name := path.Join(s.dir, transitionDir, day.Format(dayLayout)+fileSuffix)
+		records, err := readRecords(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if len(record) < 6 {
+				continue
+			}
+			ts, _ := strconv.ParseInt(record[0], 10, 64)
+			t := &Transition{
+				Time:  time.Unix(ts, 0).UTC(),
+				SN:    record[1],
+				CDSSN: record[2],
+				Kind:  record[3],
+				From:  record[4],
+				To:    record[5],
+			}
+			if t.Time.Before(since) || t.Time.After(until) {
+				continue
+			}
+			if match == nil || match(t) {
+				results = append(results, t)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	return results, nil
+}
+
+// Query returns samples between since and until sorted by time, samples are filtered by match if it is not nil
+func (s *Store) Query(since, until time.Time, match func(*Sample) bool) ([]*Sample, error) {
+	var results []*Sample
+
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(until); day = day.Add(24 * time.Hour) {
+		name := day.Format(dayLayout) + fileSuffix
+		samples, err := s.readFile(path.Join(s.dir, rawDir, name))
+		if os.IsNotExist(err) {
+			samples, err = s.readFile(path.Join(s.dir, downsampledDir, name))
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range samples {
+			if sample.Time.Before(since) || sample.Time.After(until) {
+				continue
+			}
+			if match == nil || match(sample) {
+				results = append(results, sample)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	return results, nil
+}
+
+// Compact downsamples raw files older than rawRetention into buckets of resolution,
+// and removes files older than retention.
+func (s *Store) Compact(now time.Time, rawRetention, retention, resolution time.Duration) error {
+	rawNames, err := dayFiles(path.Join(s.dir, rawDir))
+	if err != nil {
+		return err
+	}
+	for day, name := range rawNames {
+		end := day.Add(24 * time.Hour)
+		switch {
+		case now.Sub(end) > retention:
+			err = os.Remove(name)
+		case now.Sub(end) > rawRetention:
+			err = s.downsample(day, name, resolution)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{downsampledDir, transitionDir} {
+		names, err := dayFiles(path.Join(s.dir, dir))
+		if err != nil {
+			return err
+		}
+		for day, name := range names {
+			if now.Sub(day.Add(24*time.Hour)) > retention {
+				if err = os.Remove(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// downsample averages samples of the raw file in buckets of resolution then removes the raw file
+func (s *Store) downsample(day time.Time, name string, resolution time.Duration) error {
+	samples, err := s.readFile(name)
+	if err != nil {
+		return err
+	}
+	downsampled := Downsample(samples, resolution)
+
+	dir := path.Join(s.dir, downsampledDir)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("create history dir %s failed %v", dir, err)
+	}
+	filename := path.Join(dir, day.Format(dayLayout)+fileSuffix)
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create history file %s failed %v", filename, err)
+	}
+	err = writeSamples(f, downsampled)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("write history file %s failed %v", filename, err)
+	}
+	return os.Remove(name)
+}
+
+// Downsample averages samples of the same sn and kind in buckets of resolution,
+// kind is a part of the key because an icache node may have the same sn as its cds.
+func Downsample(samples []*Sample, resolution time.Duration) []*Sample {
+	type key struct {
+		sn, kind string
+		bucket   int64
+	}
+	type sum struct {
+		last                                 *Sample
+		online, hit, service, cache, monitor int64
+		count, onlineCount                   int64
+		covered                              time.Duration
+	}
+
+	var keys []key
+	sums := make(map[key]*sum)
+	for _, sample := range samples {
+		k := key{sample.SN, sample.Kind, sample.Time.Truncate(resolution).Unix()}
+		s, ok := sums[k]
+		if !ok {
+			s = new(sum)
+			sums[k] = s
+			keys = append(keys, k)
+		}
+		count := sample.Count
+		if count == 0 {
+			count = 1
+		}
+		if s.last == nil || !sample.Time.Before(s.last.Time) {
+			s.last = sample
+		}
+		s.online += sample.OnlineUser * count
+		s.hit += sample.HitUser * count
+		s.service += sample.ServiceKbps * count
+		s.cache += sample.CacheKbps * count
+		s.monitor += sample.MonitorKbps * count
+		s.count += count
+		s.onlineCount += sample.Online
+		s.covered += time.Duration(count) * sample.Interval
+	}
+
+	results := make([]*Sample, 0, len(keys))
+	for _, k := range keys {
+		s := sums[k]
+		results = append(results, &Sample{
+			Time:        time.Unix(k.bucket, 0).UTC(),
+			SN:          s.last.SN,
+			CDSSN:       s.last.CDSSN,
+			Kind:        s.last.Kind,
+			Status:      s.last.Status,
+			OnlineUser:  s.online / s.count,
+			HitUser:     s.hit / s.count,
+			ServiceKbps: s.service / s.count,
+			CacheKbps:   s.cache / s.count,
+			MonitorKbps: s.monitor / s.count,
+			Count:       s.count,
+			Online:      s.onlineCount,
+			Interval:    s.covered / time.Duration(s.count),
+			Company:     s.last.Company,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	return results
+}
+
+// dayFiles returns mapping of day to file path in dir
+func dayFiles(dir string) (map[time.Time]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history dir %s failed %v", dir, err)
+	}
+	names := make(map[time.Time]string)
+	for _, f := range files {
+		day, err := time.Parse(dayLayout, strings.TrimSuffix(f.Name(), fileSuffix))
+		if err != nil || !strings.HasSuffix(f.Name(), fileSuffix) {
+			continue
+		}
+		names[day] = path.Join(dir, f.Name())
+	}
+	return names, nil
+}
+
+func writeSamples(w io.Writer, samples []*Sample) error {
+	cw := csv.NewWriter(w)
+	for _, s := range samples {
+		count := s.Count
+		if count == 0 {
+			count = 1
+		}
+		record := []string{
+			strconv.FormatInt(s.Time.Unix(), 10),
+			s.SN,
+			s.CDSSN,
+			s.Kind,
+			s.Status,
+			strconv.FormatInt(s.OnlineUser, 10),
+			strconv.FormatInt(s.HitUser, 10),
+			strconv.FormatInt(s.ServiceKbps, 10),
+			strconv.FormatInt(s.CacheKbps, 10),
+			strconv.FormatInt(s.MonitorKbps, 10),
+			strconv.FormatInt(count, 10),
+			strconv.FormatInt(s.Online, 10),
+			strconv.FormatInt(int64(s.Interval/time.Second), 10),
+			s.Company,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readRecords reads all csv records of file, lines broken by an interrupted write are skipped
+func readRecords(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			return nil, fmt.Errorf("read history file %s failed %v", name, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *Store) readFile(name string) ([]*Sample, error) {
+	records, err := readRecords(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []*Sample
+	for _, record := range records {
+		if len(record) < 14 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(record[0], 10, 64)
+		ints := make([]int64, 0, 8)
+		for _, field := range record[5:13] {
+			n, _ := strconv.ParseInt(field, 10, 64)
+			ints = append(ints, n)
+		}
+		samples = append(samples, &Sample{
+			Time:        time.Unix(ts, 0).UTC(),
+			SN:          record[1],
+			CDSSN:       record[2],
+			Kind:        record[3],
+			Status:      record[4],
+			OnlineUser:  ints[0],
+			HitUser:     ints[1],
+			ServiceKbps: ints[2],
+			CacheKbps:   ints[3],
+			MonitorKbps: ints[4],
+			Count:       ints[5],
+			Online:      ints[6],
+			Interval:    time.Duration(ints[7]) * time.Second,
+			Company:     record[13],
+		})
+	}
+	return samples, nil
+}
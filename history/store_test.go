@@ -0,0 +1,143 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "fxoss-history")
+	if err != nil {
+		t.Fatalf("create temp dir failed %v", err)
+	}
+	return New(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestStore_AppendQuery(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+
+	start := time.Date(2026, 9, 30, 23, 58, 0, 0, time.UTC)
+	var samples []*Sample
+	for i := 0; i < 4; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		samples = append(samples,
+			&Sample{Time: ts, SN: "CAS1", CDSSN: "CAS1", Kind: "cds", Status: "warn: a, b", ServiceKbps: int64(i), Online: 1, Interval: time.Minute, Company: "南京, 大学"},
+			&Sample{Time: ts, SN: "N1", CDSSN: "CAS1", Kind: "icache", Status: "healthy", ServiceKbps: int64(i * 10)},
+		)
+	}
+	if err := store.Append(samples); err != nil {
+		t.Fatalf("append failed %v", err)
+	}
+
+	got, err := store.Query(start.Add(time.Minute), start.Add(3*time.Minute), func(s *Sample) bool { return s.SN == "CAS1" })
+	if err != nil {
+		t.Fatalf("query failed %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("query got %d samples != want 3", len(got))
+	}
+	for i, s := range got {
+		if s.ServiceKbps != int64(i+1) || s.Status != "warn: a, b" || s.Count != 1 || s.Online != 1 || s.Interval != time.Minute || s.Company != "南京, 大学" {
+			t.Errorf("sample %d got: %+v", i, s)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	start := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	samples := []*Sample{
+		{Time: start, SN: "CAS1", Status: "healthy", ServiceKbps: 10, Count: 1, Online: 1, Interval: time.Minute},
+		{Time: start.Add(20 * time.Minute), SN: "CAS1", Status: "offline", ServiceKbps: 20, Count: 1, Interval: 3 * time.Minute},
+		{Time: start.Add(70 * time.Minute), SN: "CAS1", Status: "healthy", ServiceKbps: 30, Count: 1, Online: 1},
+		{Time: start, SN: "CAS1", Kind: "icache", Status: "healthy", ServiceKbps: 100, Count: 1, Online: 1},
+	}
+	got := Downsample(samples, time.Hour)
+	if len(got) != 3 {
+		t.Fatalf("downsample got %d samples != want 3", len(got))
+	}
+	if got[1].Kind != "icache" || got[1].ServiceKbps != 100 {
+		t.Errorf("node bucket got: %+v", got[1])
+	}
+	if got[0].ServiceKbps != 15 || got[0].Count != 2 || got[0].Online != 1 || got[0].Status != "offline" || got[0].Interval != 2*time.Minute || !got[0].Time.Equal(start) {
+		t.Errorf("first bucket got: %+v", got[0])
+	}
+	if got[2].ServiceKbps != 30 || got[2].Count != 1 {
+		t.Errorf("second bucket got: %+v", got[2])
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	days := []time.Time{now.AddDate(0, 0, -30), now.AddDate(0, 0, -5), now}
+	for _, day := range days {
+		samples := []*Sample{
+			{Time: day.Truncate(time.Hour), SN: "CAS1", ServiceKbps: 10},
+			{Time: day.Truncate(time.Hour).Add(time.Minute), SN: "CAS1", ServiceKbps: 20},
+		}
+		if err := store.Append(samples); err != nil {
+			t.Fatalf("append failed %v", err)
+		}
+	}
+
+	if err := store.Compact(now, 2*24*time.Hour, 20*24*time.Hour, time.Hour); err != nil {
+		t.Fatalf("compact failed %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{path.Join(rawDir, "2026-09-19.csv"), false},
+		{path.Join(downsampledDir, "2026-09-19.csv"), false},
+		{path.Join(rawDir, "2026-10-14.csv"), false},
+		{path.Join(downsampledDir, "2026-10-14.csv"), true},
+		{path.Join(rawDir, "2026-10-19.csv"), true},
+	}
+	for _, test := range tests {
+		_, err := os.Stat(path.Join(store.dir, test.name))
+		if exists := err == nil; exists != test.exists {
+			t.Errorf("file %s exists: %t != want: %t", test.name, exists, test.exists)
+		}
+	}
+
+	got, err := store.Query(now.AddDate(0, 0, -6), now, nil)
+	if err != nil {
+		t.Fatalf("query failed %v", err)
+	}
+	if len(got) != 2 || got[0].ServiceKbps != 15 || got[0].Count != 2 {
+		t.Errorf("query after compact got %d samples, first: %+v", len(got), got[0])
+	}
+}
+
+func TestStore_Transitions(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+
+	start := time.Date(2026, 10, 1, 23, 0, 0, 0, time.UTC)
+	transitions := []*Transition{
+		{Time: start, SN: "CAS1", CDSSN: "CAS1", Kind: "cds", From: "healthy", To: "offline"},
+		{Time: start.Add(2 * time.Hour), SN: "CAS1", CDSSN: "CAS1", Kind: "cds", From: "offline", To: "warn: a, b"},
+		{Time: start.Add(3 * time.Hour), SN: "CAS2", CDSSN: "CAS2", Kind: "cds", From: "healthy", To: "offline"},
+	}
+	if err := store.AppendTransitions(transitions); err != nil {
+		t.Fatalf("append transitions failed %v", err)
+	}
+
+	got, err := store.Transitions(start, start.Add(24*time.Hour), func(t *Transition) bool { return t.SN == "CAS1" })
+	if err != nil {
+		t.Fatalf("query transitions failed %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("transitions got %d != want 2", len(got))
+	}
+	if *got[1] != *transitions[1] {
+		t.Errorf("transition got: %+v != want: %+v", got[1], transitions[1])
+	}
+}
@@ -0,0 +1,226 @@
+// Package notify sends messages of fxoss to chat bots and webhooks
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	defaultRetry   = 3
+	defaultTimeout = 10 * time.Second
+	retryDelay     = time.Second // doubled after every failed attempt, modified during testing
+)
+
+// Message is sent by notifiers, Text is markdown
+type Message struct {
+	Title string
+	Text  string
+	Time  time.Time
+}
+
+// Notifier sends messages to a destination
+type Notifier interface {
+	// Name returns the name of notifier in config
+	Name() string
+	// Payload returns the request body of the message
+	Payload(m *Message) ([]byte, error)
+	// Send sends the message and retries on temporary failure
+	Send(m *Message) error
+}
+
+// Config is the config of a notifier
+type Config struct {
+	Type    string            `json:"type"` // webhook, dingtalk or wecom
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret"`  // sign requests by HMAC-SHA256 if it is not empty
+	Retry   int               `json:"retry"`   // attempts of a message, default 3
+	Timeout string            `json:"timeout"` // timeout of a request, default 10s
+	Headers map[string]string `json:"headers"`
+}
+
+// webhook posts json payload to url, chat bots differ in payload format and signing
+type webhook struct {
+	name    string
+	conf    *Config
+	client  *http.Client
+	format  func(m *Message) interface{}
+	sign    func(req *http.Request, body []byte, secret string, now time.Time)
+	errcode bool // response has errcode and errmsg
+}
+
+type chatResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// httpError is an unexpected response status, only 429 and 5xx are retried
+type httpError struct {
+	code int
+	body string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("response status %d: %s", e.code, e.body)
+}
+
+// New creates a notifier by config
+func New(name string, c *Config) (Notifier, error) {
+	if _, err := url.Parse(c.URL); err != nil || c.URL == "" {
+		return nil, fmt.Errorf("notifier %s: illegal url %q", name, c.URL)
+	}
+	timeout := defaultTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %v", name, err)
+		}
+		timeout = d
+	}
+
+	w := &webhook{name: name, conf: c, client: &http.Client{Timeout: timeout}}
+	switch c.Type {
+	case "", "webhook":
+		w.format, w.sign = jsonFormat, headerSign
+	case "dingtalk":
+		w.format, w.sign, w.errcode = dingTalkFormat, dingTalkSign, true
+	case "wecom":
+		w.format, w.sign, w.errcode = weComFormat, headerSign, true
+	default:
+		return nil, fmt.Errorf("notifier %s: unknown type %q", name, c.Type)
+	}
+	return w, nil
+}
+
+func (w *webhook) Name() string {
+	return w.name
+}
+
+func (w *webhook) Payload(m *Message) ([]byte, error) {
+	b, err := json.Marshal(w.format(m))
+	if err != nil {
+		return nil, fmt.Errorf("json marshal message failed %v", err)
+	}
+	return b, nil
+}
+
+func (w *webhook) Send(m *Message) error {
+	body, err := w.Payload(m)
+	if err != nil {
+		return err
+	}
+
+	attempts := w.conf.Retry
+	if attempts <= 0 {
+		attempts = defaultRetry
+	}
+	delay := retryDelay
+	for i := 1; ; i++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		if e, ok := err.(*httpError); ok && e.code != http.StatusTooManyRequests && e.code < 500 {
+			break
+		}
+		if i >= attempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return fmt.Errorf("notifier %s: send message failed %v", w.name, err)
+}
+
+func (w *webhook) post(body []byte) error {
+	req, err := http.NewRequest("POST", w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.conf.Secret != "" {
+		w.sign(req, body, w.conf.Secret, time.Now())
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpError{code: resp.StatusCode, body: string(b)}
+	}
+
+	if w.errcode {
+		ret := new(chatResponse)
+		if err = json.Unmarshal(b, ret); err != nil {
+			return fmt.Errorf("json unmarshal response failed %v", err)
+		}
+		if ret.ErrCode != 0 {
+			return &httpError{code: resp.StatusCode, body: fmt.Sprintf("errcode %d %s", ret.ErrCode, ret.ErrMsg)}
+		}
+	}
+	return nil
+}
+
+// jsonFormat is the generic payload, text makes it compatible with slack
+func jsonFormat(m *Message) interface{} {
+	return map[string]string{
+		"title": m.Title,
+		"text":  m.Text,
+		"time":  m.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+func dingTalkFormat(m *Message) interface{} {
+	return map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": m.Title, "text": "### " + m.Title + "\n\n" + m.Text},
+	}
+}
+
+func weComFormat(m *Message) interface{} {
+	return map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": "### " + m.Title + "\n" + m.Text},
+	}
+}
+
+// headerSign signs timestamp and body, the receiver recomputes HMAC-SHA256 of `timestamp.body`
+func headerSign(req *http.Request, body []byte, secret string, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	req.Header.Set("X-Fxoss-Timestamp", timestamp)
+	req.Header.Set("X-Fxoss-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// dingTalkSign adds timestamp and sign of the robot security settings into url
+func dingTalkSign(req *http.Request, body []byte, secret string, now time.Time) {
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	q := req.URL.Query()
+	q.Set("timestamp", timestamp)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.URL.RawQuery = q.Encode()
+}
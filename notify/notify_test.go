@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+func TestWebhook_Send(t *testing.T) {
+	var body []byte
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer ts.Close()
+
+	n, err := New("hook", &Config{URL: ts.URL, Secret: "s3cret", Headers: map[string]string{"X-Env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Message{Title: "fxoss", Text: "hello", Time: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)}
+	if err = n.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make(map[string]string)
+	if err = json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["title"] != "fxoss" || payload["text"] != "hello" || payload["time"] != "2026-09-01T00:00:00Z" {
+		t.Errorf("payload got: %v", payload)
+	}
+	if header.Get("X-Env") != "prod" {
+		t.Errorf("header X-Env got %q", header.Get("X-Env"))
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(header.Get("X-Fxoss-Timestamp") + "."))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-Fxoss-Signature") != want {
+		t.Errorf("signature got %q != want %q", header.Get("X-Fxoss-Signature"), want)
+	}
+}
+
+func TestWebhook_Retry(t *testing.T) {
+	testCases := []struct {
+		status, retry int
+		wantCalls     int
+		wantErr       bool
+	}{
+		{http.StatusInternalServerError, 3, 3, true},
+		{http.StatusTooManyRequests, 2, 2, true},
+		{http.StatusBadRequest, 3, 1, true},
+	}
+	for _, c := range testCases {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(c.status)
+		}))
+		n, _ := New("hook", &Config{URL: ts.URL, Retry: c.retry})
+		err := n.Send(&Message{Title: "t"})
+		ts.Close()
+		if calls != c.wantCalls || (err != nil) != c.wantErr {
+			t.Errorf("status %d got %d calls err %v, want %d calls", c.status, calls, err, c.wantCalls)
+		}
+	}
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+	n, _ := New("hook", &Config{URL: ts.URL})
+	if err := n.Send(&Message{Title: "t"}); err != nil || calls != 2 {
+		t.Errorf("got %d calls err %v, want success after 2 calls", calls, err)
+	}
+}
+
+func TestDingTalk_Send(t *testing.T) {
+	var query map[string]string
+	var payload map[string]map[string]string
+	errcode := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{"timestamp": r.URL.Query().Get("timestamp"), "sign": r.URL.Query().Get("sign"), "access_token": r.URL.Query().Get("access_token")}
+		json.NewDecoder(r.Body).Decode(&payload)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": errcode, "errmsg": "bad"})
+	}))
+	defer ts.Close()
+
+	n, err := New("oncall", &Config{Type: "dingtalk", URL: ts.URL + "/robot/send?access_token=abc", Secret: "SEC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n.Send(&Message{Title: "license", Text: "- CAS1"}); err != nil {
+		t.Fatal(err)
+	}
+	if payload["markdown"]["title"] != "license" || !strings.HasSuffix(payload["markdown"]["text"], "- CAS1") {
+		t.Errorf("payload got: %v", payload)
+	}
+
+	mac := hmac.New(sha256.New, []byte("SEC"))
+	mac.Write([]byte(query["timestamp"] + "\nSEC"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); query["sign"] != want || query["access_token"] != "abc" {
+		t.Errorf("query got %v, want sign %q", query, want)
+	}
+
+	errcode = 310000
+	if err = n.Send(&Message{Title: "license"}); err == nil || !strings.Contains(err.Error(), "errcode 310000") {
+		t.Errorf("errcode should return error, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, c := range []*Config{{URL: ""}, {URL: "http://a", Type: "slack2"}, {URL: "http://a", Timeout: "ten"}} {
+		if _, err := New("x", c); err == nil {
+			t.Errorf("New(%+v) should return error", c)
+		}
+	}
+	n, err := New("x", &Config{URL: "http://a", Type: "wecom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := n.Payload(&Message{Title: "t", Text: "x"})
+	if string(b) != `{"markdown":{"content":"### t\nx"},"msgtype":"markdown"}` {
+		t.Errorf("wecom payload got %s", b)
+	}
+}
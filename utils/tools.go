@@ -7,8 +7,11 @@ import (
 	"io"
 	"math"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
@@ -39,6 +42,34 @@ var (
 	}
 )
 
+var (
+	// recorder keeps a markdown copy of messages and tables printed after StartRecord
+	recorder  *strings.Builder
+	exitHooks []func()
+	// recordMu guards recorder and exitHooks, workers print concurrently
+	recordMu    sync.Mutex
+	colorFormat = regexp.MustCompile("\033\\[[0-9;]*m")
+)
+
+var textFormats = map[color]string{
+	Blue:    "\033[1;36m%s\033[0m",
+	Green:   "\033[1;32m%s\033[0m",
+	Yellow:  "\033[1;33m%s\033[0m",
+	Red:     "\033[1;31m%s\033[0m",
+	Title:   "\033[30;42m%s\033[0m",
+	Info:    "\033[32m%s\033[0m",
+	DEFAULT: "\033[32m%s\033[0m",
+}
+
+// ColorText wraps text in different color without line break, such as a table cell
+func ColorText(text string, c color) string {
+	format, ok := textFormats[c]
+	if !ok {
+		format = textFormats[DEFAULT]
+	}
+	return fmt.Sprintf(format, text)
+}
+
 // ColorPrintln println message in different color
 func ColorPrintln(msg string, c color) {
 
@@ -51,17 +82,58 @@ func ColorPrintln(msg string, c color) {
 	}
 
 	fmt.Fprintf(out, format, msg)
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recorder != nil {
+		recorder.WriteString(StripColor(msg) + "\n\n")
+	}
 }
 
 // ErrorPrintln print message in color read
 func ErrorPrintln(msg string, exit bool) {
 	ColorPrintln(msg, Red)
 	if exit {
+		recordMu.Lock()
+		hooks := exitHooks
+		exitHooks = nil
+		recordMu.Unlock()
+		for _, f := range hooks {
+			f()
+		}
 		os.Exit(1)
 	}
 
 }
 
+// OnExit registers f to run before ErrorPrintln exits
+func OnExit(f func()) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	exitHooks = append(exitHooks, f)
+}
+
+// StartRecord starts keeping a markdown copy of messages and tables printed, tables are recorded as lists
+func StartRecord() {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	recorder = new(strings.Builder)
+}
+
+// Recorded returns the markdown copy of output since StartRecord
+func Recorded() string {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recorder == nil {
+		return ""
+	}
+	return strings.TrimSpace(recorder.String())
+}
+
+// StripColor removes color codes from text
+func StripColor(text string) string {
+	return colorFormat.ReplaceAllString(text, "")
+}
+
 // SuccessPrintln print message in color green
 func SuccessPrintln(msg string) {
 	ColorPrintln(msg, Green)
@@ -106,6 +178,20 @@ func PrintTable(headers []string, content [][]string) {
 	table.SetHeader(headers)
 	table.AppendBulk(content)
 	table.Render()
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recorder != nil {
+		recorder.WriteString("**" + strings.Join(headers, " | ") + "**\n\n")
+		for _, row := range content {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = StripColor(cell)
+			}
+			recorder.WriteString("- " + strings.Join(cells, " | ") + "\n")
+		}
+		recorder.WriteString("\n")
+	}
 }
 
 // SN2Port converts sn 2 frpc port
@@ -154,6 +240,30 @@ func CalcDiskType(length int64) int64 {
 	}
 }
 
+// DiskTier is a device type whose total disk size is not more than MaxSize bytes
+type DiskTier struct {
+	Type    int64
+	MaxSize float64
+}
+
+// CalcDiskTier calculates disk type of cds depending on total disk size,
+// the largest tier is returned if size is larger than all tiers.
+func CalcDiskTier(size float64, tiers []DiskTier) int64 {
+	if len(tiers) == 0 {
+		return 0
+	}
+	sorted := make([]DiskTier, len(tiers))
+	copy(sorted, tiers)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MaxSize < sorted[j].MaxSize })
+
+	for _, tier := range sorted {
+		if size <= tier.MaxSize {
+			return tier.Type
+		}
+	}
+	return sorted[len(sorted)-1].Type
+}
+
 // FormatUserAndSpeed foramt result as `20/10Mbps`
 func FormatUserAndSpeed(onlineUser, serviceSpeed int64) string {
 	speedStr := math.Round(float64(serviceSpeed) / float64(1024))
@@ -167,3 +277,250 @@ func IsAssertSN(sn string) bool {
 	}
 	return false
 }
+
+// FormatPercent formats value/maxValue as a percentage likes `45.2%`, `-` if maxValue is 0
+func FormatPercent(value, maxValue int64) string {
+	if maxValue == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%0.1f%%", float64(value)*100/float64(maxValue))
+}
+
+// CountRows converts counts to table rows sorted by count desc then by key
+func CountRows(counts map[string]int64) [][]string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []string{key, strconv.FormatInt(counts[key], 10)})
+	}
+	return rows
+}
+
+// StatusKind trims details of cds status, `warn: icache offline` becomes `warn`
+func StatusKind(status string) string {
+	kind := strings.SplitN(status, ":", 2)[0]
+	return strings.ToLower(strings.TrimSpace(kind))
+}
+
+// IsOnline checks the cds or node status is not offline
+func IsOnline(status string) bool {
+	kind := StatusKind(status)
+	return kind != "" && kind != "offline"
+}
+
+// ParseDuration parses duration string likes time.ParseDuration and supports `d` (day) and `w` (week) units, such as `30d` or `2w`
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for unit, d := range units {
+		if !strings.HasSuffix(s, unit) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(d)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ParseTime parses time string returned by oss api, strings without zone are in location l
+func ParseTime(s string, l *time.Location) (time.Time, error) {
+	layouts := []string{"2006-01-02 15:04:05", time.RFC3339, "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), l); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parse time %q failed", s)
+}
+
+// FormatAgo formats duration as relative time likes `3h ago`
+func FormatAgo(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "in " + strings.TrimSuffix(FormatAgo(-d), " ago")
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int64(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int64(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int64(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int64(d/(24*time.Hour)))
+	}
+}
+
+// Ratio returns value/maxValue, it returns 0 if maxValue is 0
+func Ratio(value, maxValue int64) float64 {
+	if maxValue == 0 {
+		return 0
+	}
+	return float64(value) / float64(maxValue)
+}
+
+// ParseSize parses size string likes `3.6T`, `931G` or `512MiB` to bytes in base 1024
+func ParseSize(s string) (float64, error) {
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"P", 1 << 50}, {"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	}
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I")
+	multiple := float64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(str, unit.suffix) {
+			str, multiple = strings.TrimSuffix(str, unit.suffix), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiple, nil
+}
+
+// FormatSize formats bytes as human readable size likes `3.6T`
+func FormatSize(size float64) string {
+	units := []string{"B", "K", "M", "G", "T", "P"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%0.1f%s", size, units[i])
+}
+
+// ParseNumber parses number string likes `35.1`, `35.1%` or `4.2ms`
+func ParseNumber(s string) (float64, error) {
+	str := strings.TrimSpace(s)
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "%"), "ms")
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return n, nil
+}
+
+// Percentile returns the p-th (0-100) percentile of values by nearest-rank method
+func Percentile(values []float64, p float64) float64 {
+	return WeightedPercentile(values, nil, p)
+}
+
+// WeightedPercentile returns the p-th (0-100) percentile of values by nearest-rank method,
+// a value is counted weights[i] times such as a downsampled average of raw samples.
+// Every value is counted once if weights is nil.
+func WeightedPercentile(values []float64, weights []int64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	type item struct {
+		value  float64
+		weight int64
+	}
+	sorted := make([]item, 0, len(values))
+	var total int64
+	for i, v := range values {
+		w := int64(1)
+		if weights != nil {
+			w = weights[i]
+		}
+		sorted = append(sorted, item{v, w})
+		total += w
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].value < sorted[j].value })
+
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var cum int64
+	for _, it := range sorted {
+		cum += it.weight
+		if cum >= rank {
+			return it.value
+		}
+	}
+	return sorted[len(sorted)-1].value
+}
+
+// Sparkline renders values as a line of unicode blocks, values are averaged to at most width blocks
+func Sparkline(values []float64, width int) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	if len(values) == 0 || width <= 0 {
+		return ""
+	}
+
+	if len(values) > width {
+		buckets := make([]float64, width)
+		for i := range buckets {
+			start, end := i*len(values)/width, (i+1)*len(values)/width
+			var sum float64
+			for _, v := range values[start:end] {
+				sum += v
+			}
+			buckets[i] = sum / float64(end-start)
+		}
+		values = buckets
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+
+	line := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(blocks)-1))
+		}
+		line[i] = blocks[level]
+	}
+	return string(line)
+}
+
+// RateLimiter spaces calls of Wait to rate per second among goroutines,
+// a nil RateLimiter doesn't limit.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter of rate per second, it is nil if rate is not positive
+func NewRateLimiter(rate float64) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// Wait blocks until the next call is allowed
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(d)
+}
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -180,6 +181,24 @@ func TestCalcDiskType(t *testing.T) {
 	}
 }
 
+func TestCalcDiskTier(t *testing.T) {
+	tiers := []DiskTier{{2000, 40 << 40}, {500, 8 << 40}, {1000, 20 << 40}}
+	tests := []struct {
+		size float64
+		want int64
+	}{
+		{0, 500}, {8 << 40, 500}, {10 << 40, 1000}, {30 << 40, 2000}, {100 << 40, 2000},
+	}
+	for _, test := range tests {
+		if got := CalcDiskTier(test.size, tiers); got != test.want {
+			t.Errorf("CalcDiskTier(%f) got: %d != want: %d", test.size, got, test.want)
+		}
+	}
+	if got := CalcDiskTier(100, nil); got != 0 {
+		t.Errorf("CalcDiskTier without tiers got: %d != want: 0", got)
+	}
+}
+
 func TestFoarmatUserAndSpeed(t *testing.T) {
 	var got string
 	tests := []struct {
@@ -227,3 +246,315 @@ func TestIsAssertSN(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatPercent(t *testing.T) {
+	tests := []struct {
+		value, maxValue int64
+		want            string
+	}{
+		{50, 100, "50.0%"},
+		{1, 3, "33.3%"},
+		{0, 100, "0.0%"},
+		{20, 0, "-"},
+	}
+	for _, test := range tests {
+		got := FormatPercent(test.value, test.maxValue)
+		if got != test.want {
+			t.Errorf("FormatPercent(%d, %d) got: %s != want: %s", test.value, test.maxValue, got, test.want)
+		}
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	counts := map[string]int64{"offline": 2, "healthy": 10, "warn": 2}
+	want := [][]string{{"healthy", "10"}, {"offline", "2"}, {"warn", "2"}}
+	got := CountRows(counts)
+	if len(got) != len(want) {
+		t.Fatalf("CountRows got %d rows != want %d rows", len(got), len(want))
+	}
+	for i := range want {
+		if got[i][0] != want[i][0] || got[i][1] != want[i][1] {
+			t.Errorf("CountRows row %d got: %v != want: %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStatusKind(t *testing.T) {
+	tests := []struct {
+		status, want string
+		online       bool
+	}{
+		{"healthy", "healthy", true},
+		{"warn: cnc_http_2 offline, cnc_live offline", "warn", true},
+		{"Offline", "offline", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if got := StatusKind(test.status); got != test.want {
+			t.Errorf("StatusKind(%q) got: %q != want: %q", test.status, got, test.want)
+		}
+		if got := IsOnline(test.status); got != test.online {
+			t.Errorf("IsOnline(%q) got: %t != want: %t", test.status, got, test.online)
+		}
+	}
+}
+
+func TestColorText(t *testing.T) {
+	tests := []struct {
+		c    color
+		want string
+	}{
+		{Red, "\033[1;31mhello\033[0m"},
+		{Yellow, "\033[1;33mhello\033[0m"},
+		{color(100), "\033[32mhello\033[0m"},
+	}
+	for _, test := range tests {
+		if got := ColorText("hello", test.c); got != test.want {
+			t.Errorf("ColorText(%q, %d) got: %q != want: %q", "hello", test.c, got, test.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"0.5d", 12 * time.Hour},
+		{"15m", 15 * time.Minute},
+	}
+	for _, test := range tests {
+		got, err := ParseDuration(test.s)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) failed %v", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseDuration(%q) got: %s != want: %s", test.s, got, test.want)
+		}
+	}
+	for _, s := range []string{"", "xd", "10"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q) want err but err == nil", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"2018-01-01 09:00:00", time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{"2018-12-31", time.Date(2018, 12, 30, 16, 0, 0, 0, time.UTC)},
+		{"2018-01-01T09:00:00Z", time.Date(2018, 1, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	l := time.FixedZone("CST", 8*3600)
+	for _, test := range tests {
+		got, err := ParseTime(test.s, l)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed %v", test.s, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseTime(%q) got: %s != want: %s", test.s, got, test.want)
+		}
+	}
+	if got, _ := ParseTime("2018-01-01 09:00:00", time.UTC); !got.Equal(time.Date(2018, 1, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseTime in UTC got: %s", got)
+	}
+	if _, err := ParseTime("None", l); err == nil {
+		t.Errorf("ParseTime(%q) want err but err == nil", "None")
+	}
+}
+
+func TestFormatAgo(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Second, "5s ago"},
+		{15 * time.Minute, "15m ago"},
+		{3*time.Hour + 20*time.Minute, "3h ago"},
+		{50 * time.Hour, "2d ago"},
+		{-2 * time.Minute, "in 2m"},
+	}
+	for _, test := range tests {
+		if got := FormatAgo(test.d); got != test.want {
+			t.Errorf("FormatAgo(%s) got: %s != want: %s", test.d, got, test.want)
+		}
+	}
+}
+
+func TestRatio(t *testing.T) {
+	tests := []struct {
+		value, maxValue int64
+		want            float64
+	}{
+		{50, 100, 0.5},
+		{100, 50, 2},
+		{10, 0, 0},
+	}
+	for _, test := range tests {
+		if got := Ratio(test.value, test.maxValue); got != test.want {
+			t.Errorf("Ratio(%d, %d) got: %f != want: %f", test.value, test.maxValue, got, test.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"3T", 3 << 40},
+		{"931G", 931 << 30},
+		{"1.5K", 1536},
+		{"512MiB", 512 << 20},
+		{"2GB", 2 << 30},
+		{"100", 100},
+	}
+	for _, test := range tests {
+		got, err := ParseSize(test.s)
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed %v", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseSize(%q) got: %f != want: %f", test.s, got, test.want)
+		}
+	}
+	if _, err := ParseSize("-"); err == nil {
+		t.Errorf("ParseSize(%q) want err but err == nil", "-")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size float64
+		want string
+	}{
+		{100, "100.0B"},
+		{1536, "1.5K"},
+		{3.6 * (1 << 40), "3.6T"},
+	}
+	for _, test := range tests {
+		if got := FormatSize(test.size); got != test.want {
+			t.Errorf("FormatSize(%f) got: %s != want: %s", test.size, got, test.want)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"35.1", 35.1}, {"99%", 99}, {" 4.5ms", 4.5},
+	}
+	for _, test := range tests {
+		got, err := ParseNumber(test.s)
+		if err != nil {
+			t.Errorf("ParseNumber(%q) failed %v", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNumber(%q) got: %f != want: %f", test.s, got, test.want)
+		}
+	}
+	if _, err := ParseNumber(""); err == nil {
+		t.Errorf("ParseNumber(%q) want err but err == nil", "")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{15, 20, 35, 40, 50}
+	tests := []struct {
+		p, want float64
+	}{
+		{5, 15}, {30, 20}, {40, 20}, {50, 35}, {95, 50}, {100, 50},
+	}
+	for _, test := range tests {
+		if got := Percentile(values, test.p); got != test.want {
+			t.Errorf("Percentile(%v, %v) got: %v != want: %v", values, test.p, got, test.want)
+		}
+	}
+	if got := Percentile(nil, 95); got != 0 {
+		t.Errorf("Percentile(nil, 95) got: %v != want: 0", got)
+	}
+}
+
+func TestWeightedPercentile(t *testing.T) {
+	// 10 is the average of 60 raw samples, 100 is a single raw sample
+	values, weights := []float64{100, 10}, []int64{1, 60}
+	tests := []struct {
+		p, want float64
+	}{
+		{50, 10}, {95, 10}, {98, 10}, {99, 100}, {100, 100},
+	}
+	for _, test := range tests {
+		if got := WeightedPercentile(values, weights, test.p); got != test.want {
+			t.Errorf("WeightedPercentile(%v, %v, %v) got: %v != want: %v", values, weights, test.p, got, test.want)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		width  int
+		want   string
+	}{
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, 10, "▁▂▃▄▅▆▇█"},
+		{[]float64{0, 0, 7, 7}, 2, "▁█"},
+		{[]float64{3, 3, 3}, 10, "▁▁▁"},
+		{nil, 10, ""},
+	}
+	for _, test := range tests {
+		if got := Sparkline(test.values, test.width); got != test.want {
+			t.Errorf("Sparkline(%v, %d) got: %s != want: %s", test.values, test.width, got, test.want)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	stdout := out
+	out = new(bytes.Buffer) // captured output
+	StartRecord()
+	defer func() {
+		out = stdout
+		recorder = nil
+	}()
+
+	SuccessPrintln("2 cds")
+	PrintTable([]string{"#", "sn"}, [][]string{{"1", ColorText("CAS1", Red)}, {"2", "CAS2"}})
+	want := "2 cds\n\n**# | sn**\n\n- 1 | CAS1\n- 2 | CAS2"
+	if got := Recorded(); got != want {
+		t.Errorf("Recorded() got %q != want %q", got, want)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(0)
+	l.Wait() // nil doesn't limit
+
+	l = NewRateLimiter(100)
+	wg := &sync.WaitGroup{}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				l.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	// the first call is not delayed, 11 calls are spaced by 10ms
+	if d := time.Since(start); d < 110*time.Millisecond || d > time.Second {
+		t.Errorf("12 calls at 100/s took %v", d)
+	}
+}